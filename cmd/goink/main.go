@@ -14,6 +14,7 @@ import (
 )
 
 var debug bool
+var seed int
 var defaultLogLevel = log.WarnLevel
 
 var rootCmd = &cobra.Command{
@@ -27,23 +28,31 @@ var rootCmd = &cobra.Command{
 		if js, err := os.ReadFile(args[0]); err != nil {
 			return err
 		} else {
-			ink := parser.Parse(js)
-			s := runtime.NewStory(ink)
-			runStory(s)
+			ink, err := parser.Parse(js)
+			if err != nil {
+				return err
+			}
+			opts := []runtime.StoryOption{}
+			if cmd.Flags().Changed("seed") {
+				opts = append(opts, runtime.WithSeed(seed))
+			}
+			s := runtime.NewStory(ink, opts...)
+			return runStory(s)
 		}
-		return nil
 	},
 }
 
-func runStory(s runtime.Story) {
+func runStory(s runtime.Story) error {
 	log.Debug("Starting")
 	reader := bufio.NewReader(os.Stdin)
-	s.Start()
+	if err := s.Start(); err != nil {
+		return err
+	}
 
 	for !s.IsFinished() {
 		state, err := s.RunContinuous()
 		if err != nil {
-			log.Error(err)
+			return err
 		}
 		txt, _ := state.GetTextAndTags()
 		fmt.Print(txt)
@@ -60,6 +69,7 @@ func runStory(s runtime.Story) {
 		}
 	}
 	fmt.Println("THE END")
+	return nil
 }
 
 func main() {
@@ -71,4 +81,5 @@ func main() {
 
 func init() {
 	rootCmd.PersistentFlags().BoolVarP(&debug, "debug", "d", false, "set debug logging")
+	rootCmd.PersistentFlags().IntVarP(&seed, "seed", "s", 0, "seed for the story's random number generator")
 }
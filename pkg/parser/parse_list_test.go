@@ -11,7 +11,8 @@ func TestInkWithList(t *testing.T) {
 	assert := assert.New(t)
 	js, err := os.ReadFile("../../examples/list1.json")
 	assert.NoError(err)
-	ink := Parse(js)
+	ink, err := Parse(js)
+	assert.NoError(err)
 	l, ok := ink.ListDefs["kettleState"]
 	assert.True(ok)
 	assert.Equal(1, l["cold"])
@@ -6,13 +6,13 @@ import (
 	"github.com/awwithro/goink/pkg/parser/types"
 )
 
-func Parse(rawJson []byte) types.Ink {
+func Parse(rawJson []byte) (types.Ink, error) {
 	c := types.NewContainer("", nil)
 	i := &types.Ink{
 		Root: *c,
 	}
 	if err := json.Unmarshal(rawJson, i); err != nil {
-		panic(err)
+		return types.Ink{}, err
 	}
-	return *i
+	return *i, nil
 }
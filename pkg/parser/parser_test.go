@@ -10,7 +10,10 @@ import (
 
 func TestContainer(t *testing.T) {
 	rawJson := `{"inkVersion":21,"root":[["^Once upon a time...","\n",["ev",{"^->":"0.2.$r1"},{"temp=":"$r"},"str",{"->":".^.s"},[{"#n":"$r1"}],"/str","/ev",{"*":"0.c-0","flg":18},{"s":["^There were two choices.",{"->":"$r","var":true},null]}],["ev",{"^->":"0.3.$r1"},{"temp=":"$r"},"str",{"->":".^.s"},[{"#n":"$r1"}],"/str","/ev",{"*":"0.c-1","flg":18},{"s":["^There were four lines of content.",{"->":"$r","var":true},null]}],{"c-0":["ev",{"^->":"0.c-0.$r2"},"/ev",{"temp=":"$r"},{"->":"0.2.s"},[{"#n":"$r2"}],"\n",{"->":"0.g-0"},{"#f":5}],"c-1":["ev",{"^->":"0.c-1.$r2"},"/ev",{"temp=":"$r"},{"->":"0.3.s"},[{"#n":"$r2"}],"\n",{"->":"0.g-0"},{"#f":5}],"g-0":["^They lived happily ever after.","\n","end",["done",{"#f":5,"#n":"g-1"}],{"#f":5}]}],"done",{"#f":1}],"listDefs":{}}`
-	i := Parse([]byte(rawJson))
+	i, err := Parse([]byte(rawJson))
+	if err != nil {
+		t.Fatal(err)
+	}
 	printContainer(&i.Root, 0)
 }
 
@@ -43,3 +46,26 @@ func printContainer(cnt *types.Container, depth int) {
 		}
 	}
 }
+
+func TestParseErrors(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		rawJson string
+	}{
+		{desc: "Invalid JSON", rawJson: `{"inkVersion":21,"root":[`},
+		{desc: "Unrecognized String", rawJson: `{"inkVersion":21,"root":[["florb",null],"done",null],"listDefs":{}}`},
+		{desc: "Malformed Divert", rawJson: `{"inkVersion":21,"root":[[{"->":5},null],"done",null],"listDefs":{}}`},
+		{desc: "Malformed Conditional", rawJson: `{"inkVersion":21,"root":[[{"->":"0","c":"yes"},null],"done",null],"listDefs":{}}`},
+		{desc: "Malformed Flag", rawJson: `{"inkVersion":21,"root":[["done",{"#f":"5"}],"done",null],"listDefs":{}}`},
+		{desc: "Malformed List", rawJson: `{"inkVersion":21,"root":[[{"list":{"l.a":"1"}},null],"done",null],"listDefs":{}}`},
+		{desc: "Malformed Origins", rawJson: `{"inkVersion":21,"root":[[{"list":{},"origins":"l"},null],"done",null],"listDefs":{}}`},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			_, err := Parse([]byte(tC.rawJson))
+			if err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
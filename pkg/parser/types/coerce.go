@@ -0,0 +1,112 @@
+package types
+
+import "fmt"
+
+// The types a value can be coerced between. When a binary operator is given
+// two values of different types, the one lower in this order is cast to the
+// type of the other, the same as the reference runtime
+type ValueType int
+
+const (
+	BoolType ValueType = iota
+	IntType
+	FloatType
+	ListType
+	StringType
+)
+
+func (t ValueType) String() string {
+	switch t {
+	case BoolType:
+		return "bool"
+	case IntType:
+		return "int"
+	case FloatType:
+		return "float"
+	case ListType:
+		return "list"
+	case StringType:
+		return "string"
+	}
+	return fmt.Sprintf("ValueType(%d)", int(t))
+}
+
+// Returns the type of a value that takes part in coercion. False for values
+// like divert targets that are never coerced
+func TypeOf(v any) (ValueType, bool) {
+	switch v.(type) {
+	case BoolVal:
+		return BoolType, true
+	case IntVal:
+		return IntType, true
+	case FloatVal:
+		return FloatType, true
+	case ListVal:
+		return ListType, true
+	case StringVal:
+		return StringType, true
+	}
+	return 0, false
+}
+
+// Casts x and y to the higher of their two types. Values of the same type,
+// or that can't be coerced, are returned as they are
+func Coerce(x, y any) (any, any, error) {
+	tx, okX := TypeOf(x)
+	ty, okY := TypeOf(y)
+	if !okX || !okY || tx == ty {
+		return x, y, nil
+	}
+	to := max(tx, ty)
+	// an int cast to a list is looked up in the origins of the other value
+	var list ListVal
+	if l, ok := x.(ListVal); ok {
+		list = l
+	} else if l, ok := y.(ListVal); ok {
+		list = l
+	}
+	cx, err := Cast(x, to, list)
+	if err != nil {
+		return x, y, err
+	}
+	cy, err := Cast(y, to, list)
+	if err != nil {
+		return x, y, err
+	}
+	return cx, cy, nil
+}
+
+// Casts v to the given type. Casting an int to a list gives the item with
+// that value from the origins of list, it's an error if there isn't one
+func Cast(v any, to ValueType, list ListVal) (any, error) {
+	from, ok := TypeOf(v)
+	if !ok {
+		return nil, fmt.Errorf("can't cast %T to %s", v, to)
+	}
+	if from == to {
+		return v, nil
+	}
+	switch to {
+	case IntType:
+		if b, ok := v.(BoolVal); ok {
+			return IntVal(b.AsInt()), nil
+		}
+	case FloatType:
+		if n, ok := v.(NumericVal); ok {
+			return FloatVal(n.AsFloat()), nil
+		}
+	case ListType:
+		if i, ok := v.(IntVal); ok {
+			res := list.FromInt(i.AsInt())
+			if res.Count() == 0 {
+				return nil, fmt.Errorf("could not find list item with the value %d", i)
+			}
+			return res, nil
+		}
+	case StringType:
+		if s, ok := v.(fmt.Stringer); ok {
+			return StringVal(s.String()), nil
+		}
+	}
+	return nil, fmt.Errorf("can't cast %s to %s", from, to)
+}
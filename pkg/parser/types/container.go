@@ -1,8 +1,10 @@
 package types
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -32,12 +34,75 @@ func (c *Container) Accept(v Visitor) {
 }
 
 func (c *Container) UnmarshalJSON(p []byte) error {
-	var raw []any
-	if err := json.Unmarshal(p, &raw); err != nil {
+	v, err := decodeOrdered(json.NewDecoder(bytes.NewReader(p)), "")
+	if err != nil {
 		return err
 	}
-	err := c.unmarshalContainer(raw)
-	return err
+	raw, err := as[[]any]("root", v)
+	if err != nil {
+		return err
+	}
+	return c.unmarshalContainer(raw)
+}
+
+// An item of a list literal, kept in the order it was written
+type listLiteralItem struct {
+	name  string
+	value any
+}
+
+// Decodes the next value the way json.Unmarshal into an any does, except that
+// a list literal, the object at "list", keeps its items in order
+func decodeOrdered(dec *json.Decoder, key string) (any, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		return tok, nil
+	}
+	var res any
+	switch delim {
+	case '[':
+		arr := []any{}
+		for dec.More() {
+			v, err := decodeOrdered(dec, "")
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		res = arr
+	case '{':
+		obj := map[string]any{}
+		items := []listLiteralItem{}
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			k, ok := tok.(string)
+			if !ok {
+				return nil, fmt.Errorf("object key should be a string, got %v", tok)
+			}
+			v, err := decodeOrdered(dec, k)
+			if err != nil {
+				return nil, err
+			}
+			obj[k] = v
+			items = append(items, listLiteralItem{name: k, value: v})
+		}
+		res = obj
+		if key == "list" {
+			res = items
+		}
+	}
+	// the closing ] or }
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	return res, nil
 }
 
 func (c *Container) unmarshalString(str string) error {
@@ -49,15 +114,20 @@ func (c *Container) unmarshalString(str string) error {
 	} else if op, ok := IsOperator(str); ok {
 		c.Contents = append(c.Contents, Operator(op))
 	} else {
-		log.Panic("unrecognized string ", str)
+		return fmt.Errorf("unrecognized string %q", str)
 	}
 	return nil
 }
 
 func (c *Container) unmarshalContainer(cnt []any) error {
 	// Final element is null or a specific map
+	if len(cnt) == 0 {
+		return fmt.Errorf("container %q has no final element", c.Name)
+	}
 	if finalElement, ok := cnt[len(cnt)-1].(map[string]any); ok {
-		c.parseFinalElement(finalElement)
+		if err := c.parseFinalElement(finalElement); err != nil {
+			return err
+		}
 	}
 	// Skipping the last element since we just parsed it
 	for x := 0; x < len(cnt)-1; x++ {
@@ -65,10 +135,14 @@ func (c *Container) unmarshalContainer(cnt []any) error {
 		switch typ := val.(type) {
 		case []any:
 			subContainer := NewContainer("", c)
-			subContainer.unmarshalContainer(typ)
+			if err := subContainer.unmarshalContainer(typ); err != nil {
+				return err
+			}
 			c.Contents = append(c.Contents, subContainer)
 		case string:
-			c.unmarshalString(typ)
+			if err := c.unmarshalString(typ); err != nil {
+				return err
+			}
 		// All numbers get converted to floats. strconv dance
 		// to figure out if we can use an int
 		case float64:
@@ -79,177 +153,219 @@ func (c *Container) unmarshalContainer(cnt []any) error {
 				c.Contents = append(c.Contents, FloatVal(typ))
 			}
 		case map[string]any:
-			c.unmarshalMaps(typ)
+			if err := c.unmarshalMaps(typ); err != nil {
+				return err
+			}
 		case bool:
 			c.Contents = append(c.Contents, BoolVal(typ))
 		default:
-			log.Panic("Unrecognized Container element ", val)
+			return fmt.Errorf("unrecognized container element %v", val)
 		}
 	}
 	return nil
 }
 
-func (c *Container) parseFinalElement(obj map[string]any) {
+func (c *Container) parseFinalElement(obj map[string]any) error {
 	for k, v := range obj {
 		switch k {
 		case "#n":
-			name := v.(string)
+			name, err := as[string](k, v)
+			if err != nil {
+				return err
+			}
 			c.Name = name
 		case "#f":
-			flag := v.(float64)
+			flag, err := as[float64](k, v)
+			if err != nil {
+				return err
+			}
 			c.Flag = byte(flag)
 		default:
 			if cnt, ok := v.([]any); ok {
 				subContainer := NewContainer(k, c)
-				subContainer.unmarshalContainer(cnt)
+				if err := subContainer.unmarshalContainer(cnt); err != nil {
+					return err
+				}
 				c.SubContainers[k] = subContainer
 			} else {
-				log.Panic("Unrecognized Final Element ", k, v)
+				return fmt.Errorf("unrecognized final element %s: %v", k, v)
 			}
 		}
 	}
+	return nil
 }
 
-func (c *Container) unmarshalMaps(obj map[string]any) {
+// Returns v as a T, or an error naming the key it was found at
+func as[T any](key string, v any) (T, error) {
+	t, ok := v.(T)
+	if !ok {
+		return t, fmt.Errorf("%q should be a %T, got %v", key, t, v)
+	}
+	return t, nil
+}
+
+// Returns the value at key as a T. Missing keys give the zero value
+func optional[T any](obj map[string]any, key string) (T, error) {
+	v, ok := obj[key]
+	if !ok {
+		var zero T
+		return zero, nil
+	}
+	return as[T](key, v)
+}
+
+func (c *Container) unmarshalMaps(obj map[string]any) error {
 	for k, v := range obj {
 		switch k {
-		case "^->":
-			target := v.(string)
-			c.Contents = append(c.Contents, DivertTarget(target))
-		case "^var":
-			target := v.(string)
-			ptr := NewVariablePointer(target)
-			if i, ok := obj["ci"]; ok {
-				idx := i.(float64)
-				ptr.ContextIndex = int(idx)
-			}
-			c.Contents = append(c.Contents, ptr)
-		case "->":
-			target := v.(string)
-			var conditional bool
-			var variable bool
-			if i, ok := obj["c"]; ok {
-				conditional = i.(bool)
-			}
-			if i, ok := obj["var"]; ok {
-				variable = i.(bool)
-			}
-			if variable {
-				c.Contents = append(c.Contents, VariableDivert{
-					Name:        target,
-					Conditional: conditional,
-				})
-			} else {
-				c.Contents = append(c.Contents, Divert{
-					Path:        Path(target),
-					Conditional: conditional,
-				})
-			}
-
-		case "f()":
-			target := v.(string)
-			var conditional bool
-			if i, ok := obj["c"]; ok {
-				conditional = i.(bool)
-			}
-			c.Contents = append(c.Contents, FunctionDivert{
-				Divert{
-					Path:        Path(target),
-					Conditional: conditional,
-				},
-			})
-		case "->t->":
-			target := v.(string)
-			var conditional bool
-			if i, ok := obj["c"]; ok {
-				conditional = i.(bool)
-			}
-			c.Contents = append(c.Contents, TunnelDivert{
-				Divert{
-					Path:        Path(target),
-					Conditional: conditional,
-				},
-			})
-		case "x()":
-			target := v.(string)
-			var conditional bool
-			var args int
-			if i, ok := obj["c"]; ok {
-				conditional = i.(bool)
-			}
-			if i, ok := obj["exArgs"]; ok {
-				args = int(i.(float64))
-			}
-			c.Contents = append(c.Contents, ExternalFunctionDivert{
-				Divert: Divert{
-					Path:        Path(target),
-					Conditional: conditional,
-				},
-				Args: args,
-			})
-		case "*":
-			path := v.(string)
-			var flag byte
-			if f, ok := obj["flg"]; ok {
-				flag = byte(f.(float64))
-			}
-			c.Contents = append(c.Contents, ChoicePoint{
-				Path: Path(path),
-				Flag: flag,
-			})
-		case "VAR?":
-			val := v.(string)
-			c.Contents = append(c.Contents, VarRef(val))
-		case "temp=":
-			name := v.(string)
-			var re bool
-			if r, ok := obj["re"]; ok {
-				re = r.(bool)
-			}
-			c.Contents = append(c.Contents, TempVar{
-				Name:     name,
-				ReAssign: re,
-			})
-		case "VAR=":
-			name := v.(string)
-			var re bool
-			if r, ok := obj["re"]; ok {
-				re = r.(bool)
-			}
-			c.Contents = append(c.Contents, GlobalVar{
-				Name:     name,
-				ReAssign: re,
-			})
-		case "CNT?":
-			val := v.(string)
-			c.Contents = append(c.Contents, ReadCount(val))
-		case "list":
-			val := v.(map[string]any)
-			lst := make(listDef)
-			for k, v := range val {
-				lst[k] = int(v.(float64))
-			}
-			var origins []string
-			if o, ok := obj["origins"]; ok {
-				rawOrigins := o.([]any)
-				for _,s := range rawOrigins{
-					str := s.(string)
-					origins = append(origins, str)
-				}
-			}
-			c.Contents = append(c.Contents, ListInit{
-				List:    lst,
-				Origins: origins,
-			})
 		// parsed as part of other key
 		case "var", "c", "exArgs", "ci", "flg", "re", "origins":
 			continue
-		default:
-			log.Warn("Unrecognized key ", k)
 		}
+		// every other key names the element and holds its main value
+		elem, err := parseElement(k, v, obj)
+		if err != nil {
+			return err
+		}
+		if elem != nil {
+			c.Contents = append(c.Contents, elem)
+		}
+	}
+	return nil
+}
+
+// Parses the element named by key from its object. Unrecognized keys give
+// a nil element
+func parseElement(k string, v any, obj map[string]any) (Acceptor, error) {
+	switch k {
+	case "list":
+		return parseListInit(v, obj)
+	case "^->", "^var", "->", "f()", "->t->", "x()", "*", "VAR?", "temp=", "VAR=", "CNT?":
+	default:
+		log.Warn("Unrecognized key ", k)
+		return nil, nil
+	}
+	target, err := as[string](k, v)
+	if err != nil {
+		return nil, err
+	}
+	conditional, err := optional[bool](obj, "c")
+	if err != nil {
+		return nil, err
+	}
+	re, err := optional[bool](obj, "re")
+	if err != nil {
+		return nil, err
+	}
+	switch k {
+	case "^->":
+		return DivertTarget(target), nil
+	case "^var":
+		ptr := NewVariablePointer(target)
+		idx, err := optional[float64](obj, "ci")
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := obj["ci"]; ok {
+			ptr.ContextIndex = int(idx)
+		}
+		return ptr, nil
+	case "->":
+		variable, err := optional[bool](obj, "var")
+		if err != nil {
+			return nil, err
+		}
+		if variable {
+			return VariableDivert{
+				Name:        target,
+				Conditional: conditional,
+			}, nil
+		}
+		return Divert{
+			Path:        Path(target),
+			Conditional: conditional,
+		}, nil
+	case "f()":
+		return FunctionDivert{
+			Divert{
+				Path:        Path(target),
+				Conditional: conditional,
+			},
+		}, nil
+	case "->t->":
+		return TunnelDivert{
+			Divert{
+				Path:        Path(target),
+				Conditional: conditional,
+			},
+		}, nil
+	case "x()":
+		args, err := optional[float64](obj, "exArgs")
+		if err != nil {
+			return nil, err
+		}
+		return ExternalFunctionDivert{
+			Divert: Divert{
+				Path:        Path(target),
+				Conditional: conditional,
+			},
+			Args: int(args),
+		}, nil
+	case "*":
+		flag, err := optional[float64](obj, "flg")
+		if err != nil {
+			return nil, err
+		}
+		return ChoicePoint{
+			Path: Path(target),
+			Flag: byte(flag),
+		}, nil
+	case "VAR?":
+		return VarRef(target), nil
+	case "temp=":
+		return TempVar{
+			Name:     target,
+			ReAssign: re,
+		}, nil
+	case "VAR=":
+		return GlobalVar{
+			Name:     target,
+			ReAssign: re,
+		}, nil
+	default: // "CNT?"
+		return ReadCount(target), nil
 	}
 }
 
+func parseListInit(v any, obj map[string]any) (Acceptor, error) {
+	val, err := as[[]listLiteralItem]("list", v)
+	if err != nil {
+		return nil, err
+	}
+	items := []string{}
+	for _, item := range val {
+		if _, err := as[float64](item.name, item.value); err != nil {
+			return nil, err
+		}
+		items = append(items, item.name)
+	}
+	rawOrigins, err := optional[[]any](obj, "origins")
+	if err != nil {
+		return nil, err
+	}
+	var origins []string
+	for _, o := range rawOrigins {
+		str, err := as[string]("origins", o)
+		if err != nil {
+			return nil, err
+		}
+		origins = append(origins, str)
+	}
+	return ListInit{
+		Items:   items,
+		Origins: origins,
+	}, nil
+}
+
 func (c *Container) RecordVisits() bool {
 	return c.Flag&0x1 == 1
 }
@@ -284,6 +400,51 @@ func (c *Container) GetRoot() *Container {
 	}
 }
 
+// Returns the absolute path of the container. Named containers are
+// referenced by name, anonymous ones by their index in the parent
+func (c *Container) Path() Path {
+	segs := []string{}
+	for cnt := c; cnt.ParentContainer != nil; cnt = cnt.ParentContainer {
+		if cnt.Name != "" {
+			segs = append(segs, cnt.Name)
+			continue
+		}
+		for x, obj := range cnt.ParentContainer.Contents {
+			if obj == Acceptor(cnt) {
+				segs = append(segs, strconv.Itoa(x))
+				break
+			}
+		}
+	}
+	slices.Reverse(segs)
+	return Path(strings.Join(segs, "."))
+}
+
+// Returns the container at the given absolute path. Unlike ResolvePath, every
+// segment must refer to a container
+func (c *Container) ContainerAtPath(p Path) (*Container, error) {
+	cnt := c.GetRoot()
+	for _, seg := range p.Segments() {
+		if seg.IsAddr {
+			if seg.Addr < 0 || seg.Addr >= len(cnt.Contents) {
+				return nil, fmt.Errorf("index %d out of range in path %s", seg.Addr, p)
+			}
+			next, ok := cnt.Contents[seg.Addr].(*Container)
+			if !ok {
+				return nil, fmt.Errorf("path %s addresses a non-container element", p)
+			}
+			cnt = next
+		} else {
+			next, err := cnt.GetNamedContainer(seg.Name)
+			if err != nil {
+				return nil, err
+			}
+			cnt = next
+		}
+	}
+	return cnt, nil
+}
+
 func (c *Container) PositionInParent() (int, error) {
 	if c.ParentContainer != nil {
 		_, ok := c.ParentContainer.SubContainers[c.Name]
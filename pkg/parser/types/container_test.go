@@ -63,7 +63,7 @@ func TestResolvePath(t *testing.T) {
 		currentContainer *Container
 		expectedC        *Container
 		expectedIdx      int
-		panics           bool
+		errors           bool
 	}{
 		{
 			desc:             "Parent Lookup",
@@ -88,7 +88,7 @@ func TestResolvePath(t *testing.T) {
 			path:             "1.9.Florb",
 			currentContainer: c,
 			expectedC:        nil,
-			panics:           true,
+			errors:           true,
 		},
 		{
 			desc:             "Multiple Parent Refs",
@@ -134,15 +134,47 @@ func TestResolvePath(t *testing.T) {
 	for _, tC := range testCases {
 		assert := assert.New(t)
 		t.Run(tC.desc, func(t *testing.T) {
-			if tC.panics {
-				assert.Panics(func() {
-					ResolvePath(tC.path, tC.currentContainer)
-				})
+			actualC, actualIdx, err := ResolvePath(tC.path, tC.currentContainer)
+			if tC.errors {
+				assert.Error(err)
 			} else {
-				actualC, actualIdx := ResolvePath(tC.path, tC.currentContainer)
+				assert.NoError(err)
 				assert.Equal(tC.expectedC.Name, actualC.Name)
 				assert.Equal(tC.expectedIdx, actualIdx)
 			}
 		})
 	}
 }
+
+func TestContainerPath(t *testing.T) {
+	assert := assert.New(t)
+	root := NewContainer("", nil)
+	start := NewContainer("", root)
+	knot := NewContainer("knot", root)
+	anon := NewContainer("", knot)
+	named := NewContainer("$r1", knot)
+	knot.Contents = []Acceptor{StringVal("text"), anon, named}
+	root.Contents = []Acceptor{start}
+	root.SubContainers["knot"] = knot
+
+	testCases := []struct {
+		cnt      *Container
+		expected Path
+	}{
+		{cnt: root, expected: ""},
+		{cnt: start, expected: "0"},
+		{cnt: knot, expected: "knot"},
+		{cnt: anon, expected: "knot.1"},
+		{cnt: named, expected: "knot.$r1"},
+	}
+	for _, tC := range testCases {
+		assert.Equal(tC.expected, tC.cnt.Path())
+		actual, err := root.ContainerAtPath(tC.cnt.Path())
+		assert.NoError(err)
+		assert.Same(tC.cnt, actual)
+	}
+	_, err := root.ContainerAtPath("knot.0")
+	assert.Error(err)
+	_, err = root.ContainerAtPath("missing")
+	assert.Error(err)
+}
@@ -56,6 +56,28 @@ func TestRange(t *testing.T) {
 	}
 	list := NewListVal(primes...)
 	actual := list.Range(10, 20)
-	assert.Equal("eleven,thirteen,seventeen,nineteen", actual.String())
+	assert.Equal("eleven, thirteen, seventeen, nineteen", actual.String())
 
 }
+
+func TestListRandom(t *testing.T) {
+	assert := assert.New(t)
+	def := NewListVal()
+	one := &ListValItem{Name: "one", Value: 1, Parent: &def}
+	two := &ListValItem{Name: "two", Value: 2, Parent: &def}
+	three := &ListValItem{Name: "three", Value: 3, Parent: &def}
+	def.Add(one)
+	def.Add(two)
+	def.Add(three)
+	def.Origins = []*ListVal{&def}
+
+	// counted in the order the items were added
+	list := NewListVal(three, one, two)
+	assert.Equal("three", list.Random(0).String())
+	assert.Equal("one", list.Random(1).String())
+	assert.Equal("two", list.Random(5).String())
+
+	empty := def.Without(def)
+	assert.Equal(0, empty.Random(0).Count())
+	assert.Equal("one, two, three", empty.Random(0).All().String())
+}
@@ -1,7 +1,6 @@
 package types
 
 import (
-	"math/rand"
 	"slices"
 	"strings"
 
@@ -11,6 +10,7 @@ import (
 
 var _ Comparable[ListValItem] = &ListValItem{}
 var _ Inty = &ListVal{}
+var _ Comparable[ListVal] = ListVal{}
 
 // Initial representation
 type ListDefs map[string]listDef
@@ -26,19 +26,45 @@ type ListValItem struct {
 
 // Creates a new list
 type ListInit struct {
-	List listDef
+	// The items as list.item, in the order they were written
+	Items []string
 	// Reference to the named lists in ListDefs
 	Origins []string
 }
 
 type ListVal struct {
 	mapset.Set[*ListValItem]
+	// The definitions of the lists the value was made from. An empty list
+	// still needs them to know what LIST_ALL and LIST_INVERT give
+	Origins []*ListVal
+	// The items in the order they were added. Ink walks a list in this order,
+	// which decides the item LIST_RANDOM picks
+	order *[]*ListValItem
 }
 
 func NewListVal(items ...*ListValItem) ListVal {
-	return ListVal{
-		Set: mapset.NewSet(items...),
+	l := ListVal{
+		Set:   mapset.NewSet[*ListValItem](),
+		order: &[]*ListValItem{},
 	}
+	for _, item := range items {
+		l.Add(item)
+	}
+	return l
+}
+
+// Adds the item if the list doesn't already hold it
+func (l ListVal) Add(item *ListValItem) bool {
+	if !l.Set.Add(item) {
+		return false
+	}
+	*l.order = append(*l.order, item)
+	return true
+}
+
+// Returns the items in the order they were added
+func (l ListVal) ToSlice() []*ListValItem {
+	return slices.Clone(*l.order)
 }
 
 // returns a map of list value names. If the key is duplicated, the value is true
@@ -60,16 +86,21 @@ func (l *ListDefs) GetListValItems() map[string]ListVal {
 	result := map[string]ListVal{}
 	for listName, list := range *l {
 		newList := NewListVal()
+		// a definition is its own origin
+		newList.Origins = []*ListVal{&newList}
+		items := []*ListValItem{}
 		for itemName, itemVal := range list {
-			lvi := &ListValItem{
+			items = append(items, &ListValItem{
 				Name:   itemName,
 				Value:  int(itemVal),
 				Parent: &newList,
-			}
-			newList.Add(lvi)
+			})
 		}
-		sorted := newList.ToSortedSlice()
+		// the order a definition was written in isn't kept, value order is
+		// the usual one
+		sorted := NewListVal(items...).ToSortedSlice()
 		for x, item := range sorted {
+			newList.Add(item)
 			if x+1 < len(sorted) {
 				item.Next = sorted[x+1]
 			}
@@ -137,48 +168,209 @@ func (l ListVal) Max() ListVal {
 	return NewListVal(max)
 }
 
-func (l ListVal) Random() ListVal {
-	log.Debugf("picking from %v", l.All())
+// Returns a list with the single item at rnd, modulo the size of the list,
+// counting in the order the items were added. An empty list is returned as is
+func (l ListVal) Random(rnd int) ListVal {
+	log.Debugf("picking from %v", l)
 	if l.Count() == 0 {
 		log.Debug("Empty List")
-	} else {
-		i := rand.Intn(l.Count())
-		x := 0
-		for _, val := range l.ToSlice() {
-			if x == i {
-				return NewListVal(val)
-			}
-			x++
-		}
+		return l
 	}
-	return NewListVal()
+	return NewListVal(l.ToSlice()[rnd%l.Count()])
 }
 
 func (l ListVal) AsBool() bool {
 	return l.Count() > 0
 }
 
+// Returns every item of the lists the value was made from
 func (l ListVal) All() ListVal {
-	all := NewListVal()
+	var items []*ListValItem
+	for _, origin := range l.origins() {
+		items = append(items, origin.ToSortedSlice()...)
+	}
+	return l.withItems(items)
+}
+
+// Returns the items of the lists the value was made from that aren't in it
+func (l ListVal) Invert() ListVal {
+	return l.withItems(l.All().filter(func(item *ListValItem) bool {
+		return !l.Contains(item)
+	}))
+}
+
+// The items of l, in order, that keep is true for
+func (l ListVal) filter(keep func(*ListValItem) bool) []*ListValItem {
+	var items []*ListValItem
+	for _, item := range l.ToSlice() {
+		if keep(item) {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// The definitions of the lists the value's items and origins belong to
+func (l ListVal) origins() []*ListVal {
+	origins := slices.Clone(l.Origins)
+	for _, item := range l.ToSortedSlice() {
+		if item.Parent != nil && !slices.Contains(origins, item.Parent) {
+			origins = append(origins, item.Parent)
+		}
+	}
+	return origins
+}
+
+// Returns a list of the items, in order, that keeps the origins of l and of
+// any of the others
+func (l ListVal) withItems(items []*ListValItem, others ...ListVal) ListVal {
+	origins := l.origins()
+	for _, other := range others {
+		for _, origin := range other.origins() {
+			if !slices.Contains(origins, origin) {
+				origins = append(origins, origin)
+			}
+		}
+	}
+	res := NewListVal(items...)
+	res.Origins = origins
+	return res
+}
+
+// Returns a list of the item with the value n from the lists l was made
+// from. The list is empty if none of them have an item with that value
+func (l ListVal) FromInt(n int) ListVal {
+	res := l.withItems(nil)
+	for _, origin := range res.Origins {
+		if item := origin.GetValue(n); item != nil {
+			res.Add(item)
+			break
+		}
+	}
+	return res
+}
+
+// The items in either list, those of l first
+func (l ListVal) Merge(other ListVal) ListVal {
+	return l.withItems(append(l.ToSlice(), other.ToSlice()...), other)
+}
+
+// The items of l that aren't in other
+func (l ListVal) Without(other ListVal) ListVal {
+	return l.withItems(l.filter(func(item *ListValItem) bool {
+		return !other.Contains(item)
+	}))
+}
+
+// The items in both lists, in the order of l
+func (l ListVal) Intersection(other ListVal) ListVal {
+	return l.withItems(l.filter(func(item *ListValItem) bool {
+		return other.Contains(item)
+	}))
+}
+
+// True if l holds every item of other. Like ink, an empty list neither
+// has nor is had by anything
+func (l ListVal) Has(other ListVal) bool {
+	if l.Count() == 0 || other.Count() == 0 {
+		return false
+	}
+	return l.IsSuperset(other.Set)
+}
+
+// Moves each item by n places in its own list. Items moved past either end
+// of their list are dropped
+func (l ListVal) Shift(n int) ListVal {
+	res := l.withItems(nil)
 	for _, item := range l.ToSlice() {
-		all.Set = all.Union(item.Parent.Set)
+		if item.Parent == nil {
+			continue
+		}
+		if moved := item.Parent.GetValue(item.Value + n); moved != nil {
+			res.Add(moved)
+		}
+	}
+	return res
+}
+
+// Lists are equal when they hold the same items
+func (l ListVal) Equals(other ListVal) bool {
+	return l.Set.Equal(other.Set)
+}
+
+func (l ListVal) NotEquals(other ListVal) bool {
+	return !l.Equals(other)
+}
+
+// True if every item of l is greater than every item of other
+func (l ListVal) GT(other ListVal) bool {
+	if l.Count() == 0 {
+		return false
+	}
+	if other.Count() == 0 {
+		return true
+	}
+	return l.minValue() > other.AsInt()
+}
+
+// True if the smallest and largest items of l are at least those of other
+func (l ListVal) GTE(other ListVal) bool {
+	if l.Count() == 0 {
+		return false
+	}
+	if other.Count() == 0 {
+		return true
+	}
+	return l.minValue() >= other.minValue() && l.AsInt() >= other.AsInt()
+}
+
+// True if every item of l is less than every item of other
+func (l ListVal) LT(other ListVal) bool {
+	if other.Count() == 0 {
+		return false
+	}
+	if l.Count() == 0 {
+		return true
+	}
+	return l.AsInt() < other.minValue()
+}
+
+// True if the smallest and largest items of l are at most those of other
+func (l ListVal) LTE(other ListVal) bool {
+	if other.Count() == 0 {
+		return false
+	}
+	if l.Count() == 0 {
+		return true
+	}
+	return l.AsInt() <= other.AsInt() && l.minValue() <= other.minValue()
+}
+
+// The value of the lowest item in the list, 0 if the list is empty
+func (l ListVal) minValue() int {
+	if l.Count() == 0 {
+		return 0
 	}
-	return all
+	return l.ToSortedSlice()[0].Value
 }
 
 func (l ListVal) Count() int {
 	return len(l.ToSlice())
 }
 
+// The value of the highest item in the list, 0 if the list is empty
 func (l ListVal) AsInt() int {
-	if l.Count() > 1 {
-		log.Panic("can't turn a multi-value list to an int")
+	if l.Count() == 0 {
+		return 0
 	}
-	return l.ToSlice()[0].Value
+	items := l.ToSortedSlice()
+	return items[len(items)-1].Value
 }
 
+// The items with values from min to max. The origins are kept even if no
+// items are in range
 func (l ListVal) Range(min, max int) ListVal {
-	res := NewListVal()
+	res := l.withItems(nil)
 	for _, val := range l.ToSortedSlice() {
 		if val.Value >= min && val.Value <= max {
 			res.Add(val)
@@ -187,13 +379,16 @@ func (l ListVal) Range(min, max int) ListVal {
 	return res
 }
 
+// Item names in value order, separated the way ink prints lists
 func (l ListVal) String() string {
 	keys := make([]string, 0, l.Count())
 	for _, k := range l.ToSortedSlice() {
 		keys = append(keys, k.Name)
 	}
-	return strings.Join(keys, ",")
+	return strings.Join(keys, ", ")
 }
+
+// Returns the item with the given value, nil if there isn't one
 func (l ListVal) GetValue(val int) (item *ListValItem) {
 	for _, i := range l.ToSortedSlice() {
 		if val == i.Value {
@@ -201,9 +396,6 @@ func (l ListVal) GetValue(val int) (item *ListValItem) {
 			break
 		}
 	}
-	if item == nil {
-		log.Panicf("No item with value %d", val)
-	}
 	return item
 }
 
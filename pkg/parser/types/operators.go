@@ -20,6 +20,7 @@ var operatorMap = map[string]Operator{
 	"||":          Or,
 	"MIN":         Min,
 	"MAX":         Max,
+	"POW":         Pow,
 	"LIST_VALUE":  ListValue,
 	"LIST_MIN":    ListMin,
 	"LIST_MAX":    ListMax,
@@ -30,10 +31,11 @@ var operatorMap = map[string]Operator{
 	"listInt":     ListInt,
 	"INT":         Int,
 	"FLOOR":       Floor,
+	"CEILING":     Ceiling,
 	"FLOAT":       Float,
 	"rnd":         Random,
 	"range":       ListRange,
-	"L^":          ListIntersect,
+	"L^":          ListIntersect, // ink's ^, a leading ^ would mark a string
 	"srnd":        SeedRandom,
 	"?":           Contains,
 	"!?":          NotContains,
@@ -42,7 +44,7 @@ var operatorMap = map[string]Operator{
 func (o Operator) IsUnary() bool {
 	return o == Negate || o == Not || o == ListValue ||
 		o == ListMin || o == ListMax || o == ListRandom || o == ListCount ||
-		o == Int || o == Floor || o == Float || o == ListAll || o == ListInvert || o == SeedRandom
+		o == Int || o == Floor || o == Ceiling || o == Float || o == ListAll || o == ListInvert || o == SeedRandom
 }
 
 const (
@@ -80,6 +82,8 @@ const (
 	SeedRandom
 	Contains
 	NotContains
+	Pow
+	Ceiling
 )
 
 func IsOperator(str string) (Operator, bool) {
@@ -1,10 +1,9 @@
 package types
 
 import (
+	"fmt"
 	"strconv"
 	"strings"
-
-	log "github.com/sirupsen/logrus"
 )
 
 const (
@@ -38,15 +37,21 @@ func (p Path) Segments() []Segment {
 }
 
 // Resolves to a container and the index of the contents
-func ResolvePath(p Path, current *Container) (*Container, int) {
+func ResolvePath(p Path, current *Container) (*Container, int, error) {
 	var idx int
 	root := current.GetRoot()
 	segs := p.Segments()
+	if len(segs) == 0 {
+		return nil, 0, fmt.Errorf("empty path")
+	}
 	// starts with an address
 	if segs[0].IsAddr || segs[0].Name != ParentContainer {
 		cnt := root
 		for _, seg := range segs {
 			if seg.IsAddr {
+				if seg.Addr < 0 || seg.Addr >= len(cnt.Contents) {
+					return nil, 0, fmt.Errorf("index %d of path %s is out of range", seg.Addr, p)
+				}
 				x := cnt.Contents[seg.Addr]
 				if c, ok := x.(*Container); ok {
 					cnt = c
@@ -57,52 +62,61 @@ func ResolvePath(p Path, current *Container) (*Container, int) {
 			} else {
 				c, err := cnt.GetNamedContainer(seg.Name)
 				if err != nil {
-					log.Panic(err)
+					return nil, 0, err
 				}
 				cnt = c
 				idx = 0
 			}
 		}
-		return cnt, idx
+		return cnt, idx, nil
 		// starts with '^' ie a local ref
 	} else {
 		// self ref
 		if len(segs) == 1 {
-			return current, 0
+			return current, 0, nil
 		}
 		// ignore the first ".^" since that implies the current container, not the parent, .^.^ is the parent of the current
 		// we also skip the last element and handle that as the return location
 
 		for _, seg := range segs[1 : len(segs)-1] {
 			if seg.IsAddr {
+				if seg.Addr < 0 || seg.Addr >= len(current.Contents) {
+					return nil, 0, fmt.Errorf("index %d of path %s is out of range", seg.Addr, p)
+				}
 				ct := current.Contents[seg.Addr]
 				if c, ok := ct.(*Container); ok {
 					current = c
 				} else {
-					log.Panic("path addresses through a non-container element")
+					return nil, 0, fmt.Errorf("path %s addresses through a non-container element", p)
 				}
 			} else if seg.Name != ParentContainer {
 				ct, err := current.GetNamedContainer(seg.Name)
 				if err != nil {
-					log.Panic(err)
+					return nil, 0, err
 				}
 				current = ct
 			} else {
 				current = current.ParentContainer
 			}
+			if current == nil {
+				return nil, 0, fmt.Errorf("path %s goes above the root container", p)
+			}
 		}
 		// we've parsed the path elements and are at the final address
 		seg := segs[len(segs)-1]
 		if seg.IsAddr {
-			return current, seg.Addr
+			return current, seg.Addr, nil
 		} else if seg.Name == ParentContainer {
-			return current.ParentContainer, 0
+			if current.ParentContainer == nil {
+				return nil, 0, fmt.Errorf("path %s goes above the root container", p)
+			}
+			return current.ParentContainer, 0, nil
 		} else {
 			c, err := current.GetNamedContainer(seg.Name)
 			if err != nil {
-				log.Panic("no container named ", seg.Name)
+				return nil, 0, err
 			}
-			return c, 0
+			return c, 0, nil
 		}
 
 	}
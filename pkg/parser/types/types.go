@@ -1,7 +1,11 @@
 package types
 
 import (
+	"cmp"
+	"fmt"
+	"math"
 	"strconv"
+	"strings"
 )
 
 var _ Truthy = IntVal(0)
@@ -74,25 +78,25 @@ func (b BoolVal) Accept(v Visitor) {
 }
 
 func (b BoolVal) Equals(other NumericVal) bool {
-	return b.AsBool() == other.AsBool()
+	return compareNumbers(b, other) == 0
 }
 
 func (b BoolVal) NotEquals(other NumericVal) bool {
-	return b.AsBool() == other.AsBool()
+	return !b.Equals(other)
 }
 func (b BoolVal) LT(other NumericVal) bool {
-	return b.AsInt() < other.AsInt()
+	return compareNumbers(b, other) < 0
 }
 
 func (b BoolVal) LTE(other NumericVal) bool {
-	return b.AsInt() <= other.AsInt()
+	return compareNumbers(b, other) <= 0
 }
 func (b BoolVal) GT(other NumericVal) bool {
-	return b.AsInt() > other.AsInt()
+	return compareNumbers(b, other) > 0
 }
 
 func (b BoolVal) GTE(other NumericVal) bool {
-	return b.AsInt() >= other.AsInt()
+	return compareNumbers(b, other) >= 0
 }
 
 func (b BoolVal) IsFloat() bool {
@@ -120,6 +124,21 @@ func (s StringVal) Accept(v Visitor) {
 	v.VisitString(s)
 }
 
+// Orders two numbers, comparing them as floats if either is a float
+func compareNumbers(x, y NumericVal) int {
+	if x.IsFloat() || y.IsFloat() {
+		return cmp.Compare(x.AsFloat(), y.AsFloat())
+	}
+	return cmp.Compare(x.AsInt(), y.AsInt())
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
 type IntVal int
 
 func (i IntVal) Accept(v Visitor) {
@@ -142,25 +161,25 @@ func (i IntVal) AsBool() bool {
 }
 
 func (i IntVal) Equals(other NumericVal) bool {
-	return i.AsInt() == other.AsInt()
+	return compareNumbers(i, other) == 0
 }
 
 func (i IntVal) NotEquals(other NumericVal) bool {
-	return i.AsInt() == other.AsInt()
+	return !i.Equals(other)
 }
 func (i IntVal) LT(other NumericVal) bool {
-	return i.AsInt() < other.AsInt()
+	return compareNumbers(i, other) < 0
 }
 
 func (i IntVal) LTE(other NumericVal) bool {
-	return i.AsInt() <= other.AsInt()
+	return compareNumbers(i, other) <= 0
 }
 func (i IntVal) GT(other NumericVal) bool {
-	return i.AsInt() > other.AsInt()
+	return compareNumbers(i, other) > 0
 }
 
 func (i IntVal) GTE(other NumericVal) bool {
-	return i.AsInt() >= other.AsInt()
+	return compareNumbers(i, other) >= 0
 }
 
 type FloatVal float64
@@ -168,8 +187,35 @@ type FloatVal float64
 func (f FloatVal) Accept(v Visitor) {
 	v.VisitFloatVal(f)
 }
+
+// Formats the float the way the reference runtime does. Ink's floats are
+// single precision and print with the fewest digits that read back as the
+// same value, switching to an exponent for very large or small numbers
 func (f FloatVal) String() string {
-	return strconv.FormatFloat(float64(f), 'f', -1, 64)
+	v := float64(float32(f))
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "Infinity"
+	case math.IsInf(v, -1):
+		return "-Infinity"
+	case v == 0:
+		return "0"
+	}
+	sci := strconv.FormatFloat(v, 'e', -1, 32)
+	mantissa, exp, _ := strings.Cut(sci, "e")
+	scale, _ := strconv.Atoi(exp)
+	// the number of digits before the decimal point
+	scale++
+	if scale > 9 || scale < -3 {
+		sign := "+"
+		if scale-1 < 0 {
+			sign = "-"
+		}
+		return fmt.Sprintf("%sE%s%02d", mantissa, sign, abs(scale-1))
+	}
+	return strconv.FormatFloat(v, 'f', -1, 32)
 }
 
 func (f FloatVal) IsFloat() bool {
@@ -190,7 +236,7 @@ func (f FloatVal) Equals(other NumericVal) bool {
 }
 
 func (f FloatVal) NotEquals(other NumericVal) bool {
-	return f.AsFloat() == other.AsFloat()
+	return !f.Equals(other)
 }
 
 func (f FloatVal) LT(other NumericVal) bool {
@@ -208,12 +254,31 @@ func (f FloatVal) GTE(other NumericVal) bool {
 	return f.AsFloat() >= other.AsFloat()
 }
 
+// A divert target used as a value, such as -> knot stored in a variable or
+// passed to a function
 type DivertTarget Path
 
 func (d DivertTarget) Accept(v Visitor) {
 	v.VisitDivertTarget(d)
 }
 
+func (d DivertTarget) Path() Path {
+	return Path(d)
+}
+
+func (d DivertTarget) Equals(other DivertTarget) bool {
+	return d == other
+}
+
+func (d DivertTarget) NotEquals(other DivertTarget) bool {
+	return !d.Equals(other)
+}
+
+// Printed the same way the reference runtime prints divert target values
+func (d DivertTarget) String() string {
+	return fmt.Sprintf("DivertTargetValue(%s)", string(d))
+}
+
 type Divert struct {
 	Path        Path
 	Conditional bool
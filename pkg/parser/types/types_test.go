@@ -0,0 +1,95 @@
+package types
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFloatString(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		val      FloatVal
+		expected string
+	}{
+		{desc: "Fraction", val: 3.5, expected: "3.5"},
+		{desc: "Whole number", val: 1, expected: "1"},
+		{desc: "Zero", val: 0, expected: "0"},
+		{desc: "Rounded to float precision", val: 0.1 + 0.2, expected: "0.3"},
+		{desc: "Large exponent", val: 1e10, expected: "1E+10"},
+		{desc: "Small exponent", val: 0.00001, expected: "1E-05"},
+		{desc: "Negative", val: -2.25, expected: "-2.25"},
+		{desc: "NaN", val: FloatVal(math.NaN()), expected: "NaN"},
+		{desc: "Infinity", val: FloatVal(math.Inf(1)), expected: "Infinity"},
+		{desc: "Negative Infinity", val: FloatVal(math.Inf(-1)), expected: "-Infinity"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			assert.Equal(t, tC.expected, tC.val.String())
+		})
+	}
+}
+
+func TestMixedComparisons(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(IntVal(1).Equals(FloatVal(1)))
+	assert.False(IntVal(1).NotEquals(FloatVal(1)))
+	assert.True(IntVal(1).NotEquals(FloatVal(1.5)))
+	assert.True(IntVal(1).LT(FloatVal(1.5)))
+	assert.True(FloatVal(2.5).GT(IntVal(2)))
+	assert.True(BoolVal(true).Equals(IntVal(1)))
+	assert.True(BoolVal(false).NotEquals(IntVal(1)))
+}
+
+func TestCoerce(t *testing.T) {
+	items := []*ListValItem{{Name: "a", Value: 1}, {Name: "b", Value: 2}}
+	def := NewListVal(items...)
+	def.Origins = []*ListVal{&def}
+	list := def.FromInt(1)
+
+	testCases := []struct {
+		desc      string
+		x, y      any
+		expectedX any
+		expectedY any
+	}{
+		{desc: "Same types", x: IntVal(1), y: IntVal(2), expectedX: IntVal(1), expectedY: IntVal(2)},
+		{desc: "Bool to int", x: BoolVal(true), y: IntVal(2), expectedX: IntVal(1), expectedY: IntVal(2)},
+		{desc: "Int to float", x: IntVal(1), y: FloatVal(2.5), expectedX: FloatVal(1), expectedY: FloatVal(2.5)},
+		{desc: "Number to string", x: StringVal("a"), y: FloatVal(2.5), expectedX: StringVal("a"), expectedY: StringVal("2.5")},
+		{desc: "List to string", x: list, y: StringVal("!"), expectedX: StringVal("a"), expectedY: StringVal("!")},
+		{desc: "Int to list", x: list, y: IntVal(2), expectedX: list, expectedY: def.FromInt(2)},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			assert := assert.New(t)
+			x, y, err := Coerce(tC.x, tC.y)
+			assert.NoError(err)
+			assert.Equal(tC.expectedX, x)
+			assert.Equal(tC.expectedY, y)
+		})
+	}
+}
+
+func TestCastErrors(t *testing.T) {
+	assert := assert.New(t)
+	_, err := Cast(FloatVal(1.5), IntType, ListVal{})
+	assert.Error(err)
+	_, err = Cast(Path("knot"), StringType, ListVal{})
+	assert.Error(err)
+
+	def := NewListVal(&ListValItem{Name: "a", Value: 1})
+	def.Origins = []*ListVal{&def}
+	_, err = Cast(IntVal(5), ListType, def)
+	assert.EqualError(err, "could not find list item with the value 5")
+}
+
+func TestDivertTarget(t *testing.T) {
+	assert := assert.New(t)
+	d := DivertTarget("knot.stitch")
+	assert.Equal("DivertTargetValue(knot.stitch)", d.String())
+	assert.Equal(Path("knot.stitch"), d.Path())
+	assert.True(d.Equals(DivertTarget("knot.stitch")))
+	assert.True(d.NotEquals(DivertTarget("knot")))
+}
@@ -0,0 +1,157 @@
+package runtime
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/awwithro/goink/pkg/parser/types"
+)
+
+// The kind of call that pushed a frame onto the call stack
+type FrameType int
+
+const (
+	// The bottom of the stack, where the story runs outside of any call
+	RootFrame FrameType = iota
+	// A function call, returned from with ~ret
+	FunctionFrame
+	// A tunnel, returned from with ->->
+	TunnelFrame
+	// A thread forked by <-. Running out of content in it resumes the
+	// thread that forked it
+	ThreadFrame
+	// A function called by the host with EvaluateFunction
+	EvaluationFrame
+)
+
+func (t FrameType) String() string {
+	switch t {
+	case RootFrame:
+		return "root"
+	case FunctionFrame:
+		return "function"
+	case TunnelFrame:
+		return "tunnel"
+	case ThreadFrame:
+		return "thread"
+	case EvaluationFrame:
+		return "evaluation"
+	}
+	return fmt.Sprintf("FrameType(%d)", int(t))
+}
+
+// A frame of the call stack. Each has its own temps
+type Frame struct {
+	Type FrameType
+	// where the caller resumes once the frame returns
+	returnAddress Address
+	returnMode    Mode
+	// where the function's output starts until it writes any text, else -1
+	outputStart int
+	temps       map[string]any
+}
+
+// The frames of a single thread. There's always a root frame at the bottom
+type CallStack struct {
+	frames []*Frame // bottom of the stack first
+}
+
+func newCallStack() *CallStack {
+	return &CallStack{frames: []*Frame{{Type: RootFrame, outputStart: -1, temps: map[string]any{}}}}
+}
+
+// The frame that's running
+func (c *CallStack) current() *Frame {
+	return c.frames[len(c.frames)-1]
+}
+
+func (c *CallStack) push(f *Frame) {
+	c.frames = append(c.frames, f)
+}
+
+// Pops the top frame as long as it's one of the expected types. The root
+// frame is never popped
+func (c *CallStack) pop(expected ...FrameType) (*Frame, error) {
+	top := c.current()
+	if top.Type == RootFrame {
+		return nil, fmt.Errorf("there's nothing on the call stack to return from")
+	}
+	if !slices.Contains(expected, top.Type) {
+		return nil, fmt.Errorf("the current frame is a %s", top.Type)
+	}
+	c.frames = c.frames[:len(c.frames)-1]
+	return top, nil
+}
+
+// Number of function and tunnel calls on the stack
+func (c *CallStack) callDepth() int {
+	depth := 0
+	for _, f := range c.frames {
+		if f.Type == FunctionFrame || f.Type == TunnelFrame || f.Type == EvaluationFrame {
+			depth++
+		}
+	}
+	return depth
+}
+
+// A copy that can be changed without affecting this stack
+func (c *CallStack) copy() *CallStack {
+	frames := make([]*Frame, len(c.frames))
+	for x, f := range c.frames {
+		cp := *f
+		cp.temps = maps.Clone(f.temps)
+		frames[x] = &cp
+	}
+	return &CallStack{frames: frames}
+}
+
+// Removes thread frames once their thread is the only one left, which
+// happens when a choice made in it is taken. Each thread frame's temps
+// replace those of the frame below it, which they were copied from when
+// the thread was forked
+func (c *CallStack) collapseThreads() {
+	for x := len(c.frames) - 1; x > 0; x-- {
+		if c.frames[x].Type != ThreadFrame {
+			continue
+		}
+		c.frames[x-1].temps = c.frames[x].temps
+		c.frames = slices.Delete(c.frames, x, x+1)
+		// refs to the removed frame or above now point one frame lower
+		removed := x + 1
+		for _, f := range c.frames {
+			for name, val := range f.temps {
+				if p, ok := val.(types.VariablePointer); ok && p.ContextIndex >= removed {
+					p.ContextIndex--
+					f.temps[name] = p
+				}
+			}
+		}
+	}
+}
+
+// Describes a frame of the call stack for debugging
+type FrameInfo struct {
+	Type FrameType
+	// where the caller resumes, empty for root and thread frames
+	Return types.Path
+	// temp vars, converted to their go equivalents where one exists
+	Temps map[string]any
+}
+
+// The frames of the running thread, bottom of the stack first
+func (s *Story) CallStack() []FrameInfo {
+	frames := s.state.callStack.frames
+	info := make([]FrameInfo, 0, len(frames))
+	for _, f := range frames {
+		fi := FrameInfo{Type: f.Type, Temps: make(map[string]any, len(f.temps))}
+		if f.returnAddress.C != nil {
+			fi.Return = contentPath(f.returnAddress)
+		}
+		for name, val := range f.temps {
+			fi.Temps[name] = toGoValue(val)
+		}
+		info = append(info, fi)
+	}
+	return info
+}
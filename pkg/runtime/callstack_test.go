@@ -0,0 +1,106 @@
+package runtime
+
+import (
+	"testing"
+
+	"github.com/awwithro/goink/pkg/parser/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCallStackFrames(t *testing.T) {
+	assert := assert.New(t)
+	s := NewStory(loadExample(t, "callstack_frames"))
+	var frames []FrameInfo
+	assert.NoError(s.BindExternalFunction("peek", func() { frames = s.CallStack() }))
+	assert.NoError(s.Start())
+	_, err := s.RunContinuous()
+	assert.NoError(err)
+	assert.Equal([]FrameInfo{
+		{Type: RootFrame, Temps: map[string]any{}},
+		{Type: TunnelFrame, Return: types.Path("0.1"), Temps: map[string]any{}},
+		{Type: FunctionFrame, Return: types.Path("t.2"), Temps: map[string]any{"z": 3}},
+	}, frames)
+	assert.Len(s.CallStack(), 1)
+}
+
+func TestCallStackReturns(t *testing.T) {
+	testCases := []struct {
+		desc string
+		js   string
+		err  string
+	}{
+		// returns that don't match their frame aren't something the compiler
+		// outputs so these are built by hand
+		{
+			// -> t ->
+			// after
+			// == t ==
+			// ~ return
+			desc: "Function return in a tunnel",
+			js:   `{"inkVersion":21,"root":[[{"->t->":"t"},"^after","\n","end",null],"done",{"t":["ev","void","/ev","~ret",{"#f":1}],"#f":1}],"listDefs":{}}`,
+			err:  "found a function return (~ret) but the current frame is a tunnel",
+		},
+		{
+			// ~ f()
+			// == function f ==
+			// ->->
+			desc: "Tunnel return in a function",
+			js:   `{"inkVersion":21,"root":[["ev",{"f()":"f"},"pop","/ev","end",null],"done",{"f":["ev","void","/ev","->->",{"#f":1}],"#f":1}],"listDefs":{}}`,
+			err:  "found a tunnel return (->->) but the current frame is a function",
+		},
+		{
+			// hello
+			// ->->
+			desc: "Tunnel return outside a tunnel",
+			js:   `{"inkVersion":21,"root":[["^hello","\n","ev","void","/ev","->->","end",null],"done",{"#f":1}],"listDefs":{}}`,
+			err:  "nothing on the call stack to return from",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			s := NewStory(parseInk(t, []byte(tC.js)))
+			assert.NoError(t, s.Start())
+			_, err := s.RunContinuous()
+			assert.ErrorContains(t, err, tC.err)
+		})
+	}
+
+	// a tunnel that runs out of content ends the story
+	s, state := startExample(t, "tunnel_end")
+	text, _ := state.GetTextAndTags()
+	assert.Equal(t, "inside\n", text)
+	assert.Equal(t, 0, s.evaluationStack.Size())
+}
+
+func TestCallStackSavedInTunnel(t *testing.T) {
+	assert := assert.New(t)
+	ink := loadExample(t, "tunnel_save")
+	s := NewStory(ink)
+	assert.NoError(s.Start())
+	_, err := s.RunContinuous()
+	assert.NoError(err)
+	data, err := s.SaveState()
+	assert.NoError(err)
+
+	loaded := NewStory(ink)
+	assert.NoError(loaded.LoadState(data))
+	assert.Equal(s.CallStack(), loaded.CallStack())
+	assert.NoError(loaded.ChoseIndex(0))
+	state, err := loaded.RunContinuous()
+	assert.NoError(err)
+	text, _ := state.GetTextAndTags()
+	assert.Equal("6\n1\n", text)
+}
+
+func TestImplicitReturnAfterChoices(t *testing.T) {
+	assert := assert.New(t)
+	// f runs out of content once the first choice is already there, it still
+	// returns so the second choice's text can be finished
+	s, state := startExample(t, "implicit_return")
+	choices := state.GetChoices()
+	if assert.Len(choices, 2) {
+		assert.Equal("one", choices[0].ChoiceText())
+		assert.Equal("hi two", choices[1].ChoiceText())
+	}
+	assert.Len(s.CallStack(), 1)
+}
@@ -0,0 +1,83 @@
+package runtime
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChoosePathString(t *testing.T) {
+	testCases := []struct {
+		desc         string
+		path         string
+		args         []any
+		expectedText string
+		errors       bool
+	}{
+		{
+			desc:         "Knot with args",
+			path:         "greet",
+			args:         []any{"Bob", 3},
+			expectedText: "Hello Bob x3\n",
+		},
+		{
+			desc:         "Stitch",
+			path:         "market.haggle",
+			expectedText: "Haggling.\n",
+		},
+		{
+			desc:   "Missing knot",
+			path:   "bakery",
+			errors: true,
+		},
+		{
+			desc:   "Relative path",
+			path:   ".^.haggle",
+			errors: true,
+		},
+		{
+			desc:   "Unsupported arg",
+			path:   "greet",
+			args:   []any{struct{}{}, 1},
+			errors: true,
+		},
+	}
+	ink := loadExample(t, "choose_path")
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			assert := assert.New(t)
+			s := NewStory(ink)
+			assert.NoError(s.Start())
+			_, err := s.RunContinuous()
+			assert.NoError(err)
+			assert.True(s.IsFinished())
+
+			err = s.ChoosePathString(tC.path, tC.args...)
+			if tC.errors {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+			state, err := s.RunContinuous()
+			assert.NoError(err)
+			txt, _ := state.GetTextAndTags()
+			assert.Equal(tC.expectedText, txt)
+		})
+	}
+}
+
+func TestChoosePathCountsTurns(t *testing.T) {
+	assert := assert.New(t)
+	s := NewStory(loadExample(t, "choose_path_turns"))
+	assert.NoError(s.Start())
+	expected := []string{"0 0\n", "1 1 0\n", "2 2 0\n"}
+	for x, exp := range expected {
+		if x > 0 {
+			assert.NoError(s.ChoosePathString("other"))
+		}
+		state, err := s.RunContinuous()
+		assert.NoError(err)
+		text, _ := state.GetTextAndTags()
+		assert.Equal(exp, text)
+	}
+}
@@ -0,0 +1,119 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+)
+
+// Returned by Continue when there are no more lines until a choice is made
+var ErrNoMoreLines = errors.New("no more lines to continue with")
+
+// Runs the story until a full line of output is ready and returns it along
+// with its tags. A line is only returned once content that follows it has
+// been evaluated, so glue on the next line can still join onto it. Lines are
+// taken from those returned by the state's GetLines. ErrNoMoreLines is
+// returned once the story stops for a choice, the end or an asynchronous
+// external function
+func (s *Story) Continue() (Line, error) {
+	defer s.beginRun(context.Background())()
+	s.startObserverBatch()
+	defer s.endObserverBatch()
+	for len(s.state.lines) == 0 {
+		if !s.state.CanContinue() {
+			return Line{}, ErrNoMoreLines
+		}
+		if _, err := s.step(); err != nil {
+			return Line{}, err
+		}
+		for s.takeFinishedLine() {
+		}
+	}
+	line := s.state.lines[0]
+	s.state.lines = s.state.lines[1:]
+	return line, nil
+}
+
+// Continues line by line until a line that matches is found and returns it
+func (s *Story) ContinueUntil(match func(line Line) bool) (Line, error) {
+	for {
+		line, err := s.Continue()
+		if err != nil || match(line) {
+			return line, err
+		}
+	}
+}
+
+// Moves the first line of the output buffer to the state's lines once it's
+// followed by content glue can't remove. Returns false if there's no such line
+func (s *Story) takeFinishedLine() bool {
+	if s.mode != None {
+		return false
+	}
+	items := s.outputBuffer
+	end := slices.IndexFunc(items, outputItem.isNewline)
+	if end < 0 {
+		return false
+	}
+	// text or tags after the newline mean nothing can glue onto the line
+	extended := slices.ContainsFunc(items[end+1:], outputItem.isNonWhitespace) ||
+		slices.ContainsFunc(s.state.outputTags, func(t outputTag) bool {
+			return t.pos > end
+		})
+	if !extended {
+		return false
+	}
+	var lineTags, rest []outputTag
+	for _, t := range s.state.outputTags {
+		if t.pos <= end {
+			lineTags = append(lineTags, t)
+		} else {
+			t.pos -= end + 1
+			rest = append(rest, t)
+		}
+	}
+	lines := splitLines(items[:end+1], lineTags)
+	// tags on a line without text belong to the next one
+	if len(lines) > 0 && lines[len(lines)-1].Text == "" {
+		carried := []outputTag{}
+		for _, tag := range lines[len(lines)-1].Tags {
+			carried = append(carried, outputTag{tag: tag})
+		}
+		rest = append(carried, rest...)
+		lines = lines[:len(lines)-1]
+	}
+	s.state.lines = append(s.state.lines, lines...)
+	s.state.outputTags = rest
+	s.outputBuffer = slices.Clone(items[end+1:])
+	return true
+}
+
+// Runs the story like RunContinuous but returns once budget is spent so a
+// long run can be spread over several calls, such as one per frame of a game.
+// Each call picks up where the last one stopped. done is true once the story
+// stops for a choice, the end or an asynchronous external function, at which
+// point State holds the output. At least one instruction is evaluated per
+// call so a run always makes progress
+func (s *Story) ContinueFor(budget time.Duration) (done bool, err error) {
+	deadline := time.Now().Add(budget)
+	defer s.beginRun(context.Background())()
+	if s.continuing {
+		// the instruction limit covers the whole run rather than each slice
+		s.instructions = s.continuedInstructions
+	}
+	s.startObserverBatch()
+	defer s.endObserverBatch()
+	for {
+		state, err := s.step()
+		if err != nil || !state.CanContinue() || state.Finished {
+			s.continuing = false
+			return true, err
+		}
+		if !time.Now().Before(deadline) {
+			s.continuing = true
+			s.continuedInstructions = s.instructions
+			return false, nil
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package runtime
+
+import (
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/awwithro/goink/pkg/parser/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContinueFor(t *testing.T) {
+	assert := assert.New(t)
+	js, err := os.ReadFile("../../examples/crimescene.json")
+	assert.NoError(err)
+	ink := parseInk(t, js)
+
+	expected := NewStory(ink, WithSeed(1))
+	assert.NoError(expected.Start())
+	sliced := NewStory(ink, WithSeed(1))
+	assert.NoError(sliced.Start())
+
+	for x := 0; x < 3 && !expected.IsFinished(); x++ {
+		want, err := expected.RunContinuous()
+		assert.NoError(err)
+
+		// a zero budget evaluates a single instruction per call
+		calls := 0
+		for done := false; !done; calls++ {
+			done, err = sliced.ContinueFor(0)
+			assert.NoError(err)
+		}
+		assert.Greater(calls, 1)
+		got := sliced.State()
+		wantText, wantTags := want.GetTextAndTags()
+		gotText, gotTags := got.GetTextAndTags()
+		assert.Equal(wantText, gotText)
+		assert.Equal(wantTags, gotTags)
+		assert.Equal(len(want.GetChoices()), len(got.GetChoices()))
+		if len(want.GetChoices()) == 0 {
+			break
+		}
+		assert.NoError(expected.ChoseIndex(0))
+		assert.NoError(sliced.ChoseIndex(0))
+	}
+}
+
+func TestContinueForInstructionLimit(t *testing.T) {
+	js := `{"inkVersion":21,"root":[[{"->":"loop"},null],"done",{"loop":[{"->":"loop"},{"#f":1}],"#f":1}],"listDefs":{}}`
+	s := NewStory(parseInk(t, []byte(js)), WithLimits(Limits{MaxInstructions: 100}))
+	assert.NoError(t, s.Start())
+	// the limit applies to the whole run, not each slice of it
+	var err error
+	for x, done := 0, false; !done && x < 200; x++ {
+		done, err = s.ContinueFor(0)
+	}
+	assert.ErrorIs(t, err, ErrInstructionLimit)
+}
+
+func TestContinue(t *testing.T) {
+	// Hello
+	// <> world
+	// #portrait
+	// Second #mood
+	// Third
+	// * [A] -> END
+	js := `{"inkVersion":21,"root":[["^Hello","\n","<>","^ world","\n","#","^portrait","/#","^Second ","#","^mood","/#","\n","^Third","\n","ev","str","^A","/str","/ev",{"*":"0.c-0","flg":20},{"c-0":["end",{"#f":5}]}],"done",{"#f":1}],"listDefs":{}}`
+	assert := assert.New(t)
+	s := NewStory(parseInk(t, []byte(js)))
+	assert.NoError(s.Start())
+
+	expected := []Line{
+		{Text: "Hello world"},
+		{Text: "Second", Tags: []types.Tag{"portrait", "mood"}},
+		{Text: "Third"},
+	}
+	for _, exp := range expected {
+		line, err := s.Continue()
+		assert.NoError(err)
+		assert.Equal([]Line{exp}, stripSegments([]Line{line}))
+	}
+	_, err := s.Continue()
+	assert.ErrorIs(err, ErrNoMoreLines)
+	state := s.State()
+	assert.Len(state.GetChoices(), 1)
+}
+
+func TestContinueUntil(t *testing.T) {
+	assert := assert.New(t)
+	js, err := os.ReadFile("../../examples/tag.json")
+	assert.NoError(err)
+	s := NewStory(parseInk(t, js))
+	assert.NoError(s.Start())
+	line, err := s.ContinueUntil(func(line Line) bool {
+		return slices.Contains(line.Tags, "another")
+	})
+	assert.NoError(err)
+	assert.Equal("Hello", line.Text)
+
+	_, err = s.ContinueUntil(func(line Line) bool { return true })
+	assert.ErrorIs(err, ErrNoMoreLines)
+}
@@ -0,0 +1,64 @@
+package runtime
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDivertTargetValues(t *testing.T) {
+	assert := assert.New(t)
+	_, state := startExample(t, "divert_targets")
+	text, _ := state.GetTextAndTags()
+	assert.Equal("true true\nDivertTargetValue(knot)\nJumping.\nOther.\nKnot.\n", text)
+}
+
+func TestTunnelOnwards(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		choices   []int
+		expected  string // text of the last turn
+		callStack int
+	}{
+		{
+			// the cellar tunnel is left waiting on the stack
+			desc:      "Onwards from a nested tunnel",
+			choices:   []int{1},
+			expected:  "You go down into the cellar.\nThe stairs lead straight back up to the hall.\nYou stand in the hall.\n",
+			callStack: 2,
+		},
+		{
+			desc:      "Onwards to a divert param",
+			choices:   []int{2},
+			expected:  "You step out into the garden.\nYou stand in the hall.\n",
+			callStack: 1,
+		},
+		{
+			desc:      "Chained tunnels",
+			choices:   []int{0},
+			expected:  "The tour starts in the kitchen.\nThen the library.\nIt ends back in the hall.\nYou stand in the hall.\n",
+			callStack: 1,
+		},
+		{
+			desc:      "Chained tunnel returning onwards",
+			choices:   []int{3},
+			expected:  "The bell rings out.\nYou step out into the garden.\nYou stand in the hall.\n",
+			callStack: 1,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			s, state := startExample(t, "tunnel_onwards")
+			var err error
+			for _, c := range tC.choices {
+				assert.NoError(t, s.ChoseIndex(c))
+				state, err = s.RunContinuous()
+				assert.NoError(t, err)
+			}
+			text, _ := state.GetTextAndTags()
+			assert.Equal(t, tC.expected, text)
+			assert.Equal(t, 0, s.evaluationStack.Size())
+			assert.Len(t, s.CallStack(), tC.callStack)
+		})
+	}
+}
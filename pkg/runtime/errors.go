@@ -0,0 +1,90 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/awwithro/goink/pkg/parser/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// Returned when the story can't be evaluated any further. It describes
+// where in the ink the error happened and the state of the stacks at the time
+type RuntimeError struct {
+	Message   string
+	Path      types.Path // path of the container being evaluated
+	Container string
+	Index     int
+	CallStack []types.Path // return locations, innermost first
+	EvalStack []string     // values on the evaluation stack, top first
+	Err       error        // the underlying error, if any
+}
+
+func (e *RuntimeError) Error() string {
+	sb := strings.Builder{}
+	sb.WriteString(e.Message)
+	if e.Err != nil && e.Err.Error() != e.Message {
+		fmt.Fprintf(&sb, ": %v", e.Err)
+	}
+	fmt.Fprintf(&sb, " at %s (container %q, index %d)", e.Path, e.Container, e.Index)
+	if len(e.CallStack) > 0 {
+		fmt.Fprintf(&sb, "\ncall stack: %v", e.CallStack)
+	}
+	if len(e.EvalStack) > 0 {
+		fmt.Fprintf(&sb, "\nevaluation stack: %v", e.EvalStack)
+	}
+	return sb.String()
+}
+
+func (e *RuntimeError) Unwrap() error {
+	return e.Err
+}
+
+func (s *Story) newRuntimeError(msg string, err error) *RuntimeError {
+	rErr := &RuntimeError{
+		Message: msg,
+		Index:   s.currentAddress.I,
+		Err:     err,
+	}
+	if s.currentAddress.C != nil {
+		rErr.Path = s.currentAddress.C.Path()
+		rErr.Container = s.currentAddress.C.Name
+	}
+	frames := s.state.callStack.frames
+	for x := len(frames) - 1; x >= 0; x-- {
+		// root and thread frames aren't calls so have nowhere to return to
+		if frames[x].Type == RootFrame || frames[x].Type == ThreadFrame {
+			continue
+		}
+		rErr.CallStack = append(rErr.CallStack, contentPath(frames[x].returnAddress))
+	}
+	for _, val := range s.evaluationStack.Values() {
+		rErr.EvalStack = append(rErr.EvalStack, fmt.Sprintf("%T(%v)", val, val))
+	}
+	return rErr
+}
+
+// Errors during evaluation panic out of the visitor. The public entry points
+// recover them here and return them as a RuntimeError
+func (s *Story) recoverRuntimeError(err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	var rErr *RuntimeError
+	switch v := r.(type) {
+	case *RuntimeError:
+		rErr = v
+	case error:
+		if !errors.As(v, &rErr) {
+			rErr = s.newRuntimeError(v.Error(), v)
+		}
+	case *log.Entry:
+		rErr = s.newRuntimeError(v.Message, nil)
+	default:
+		rErr = s.newRuntimeError(fmt.Sprint(v), nil)
+	}
+	log.Debug("Recovered from runtime error: ", rErr)
+	*err = rErr
+}
@@ -0,0 +1,61 @@
+package runtime
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/awwithro/goink/pkg/parser/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuntimeErrors(t *testing.T) {
+	testCases := []struct {
+		desc          string
+		json          string
+		expectedPath  types.Path
+		expectedIndex int
+		callStack     []types.Path
+	}{
+		{
+			desc:          "Divert to a missing knot",
+			json:          `{"inkVersion":21,"root":[["^hello",{"->":"missing"},null],"done",null],"listDefs":{}}`,
+			expectedPath:  "0",
+			expectedIndex: 1,
+		},
+		{
+			desc:          "Operator on an empty stack",
+			json:          `{"inkVersion":21,"root":[["ev",1,"+","/ev",null],"done",null],"listDefs":{}}`,
+			expectedPath:  "0",
+			expectedIndex: 2,
+		},
+		{
+			desc:          "Error inside a function",
+			json:          `{"inkVersion":21,"root":[["ev",{"f()":"fn"},"/ev",null],"done",{"fn":["ev",true,"str","/str","-","/ev",{"#f":1}]}],"listDefs":{}}`,
+			expectedPath:  "fn",
+			expectedIndex: 4,
+			callStack:     []types.Path{"0.2"},
+		},
+		{
+			// LIST l = a, b
+			// {l == 5}
+			desc:          "Int with no matching list item",
+			json:          `{"inkVersion":21,"root":[["ev",{"VAR?":"l"},5,"==","out","/ev","\n","end",null],"done",{"global decl":["ev",{"list":{"l.a":1,"l.b":2}},{"VAR=":"l"},"/ev","end",null],"#f":1}],"listDefs":{"l":{"a":1,"b":2}}}`,
+			expectedPath:  "0",
+			expectedIndex: 3,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			assert := assert.New(t)
+			s := NewStory(parseInk(t, []byte(tC.json)))
+			assert.NoError(s.Start())
+			_, err := s.RunContinuous()
+			var rErr *RuntimeError
+			if assert.True(errors.As(err, &rErr), "expected a RuntimeError, got %v", err) {
+				assert.Equal(tC.expectedPath, rErr.Path)
+				assert.Equal(tC.expectedIndex, rErr.Index)
+				assert.Equal(tC.callStack, rErr.CallStack)
+			}
+		})
+	}
+}
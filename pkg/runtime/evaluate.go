@@ -0,0 +1,95 @@
+package runtime
+
+import (
+	"fmt"
+
+	"github.com/awwithro/goink/pkg/parser/types"
+	"github.com/emirpasic/gods/v2/stacks/arraystack"
+	log "github.com/sirupsen/logrus"
+)
+
+// Functions called by EvaluateFunction return to this empty container
+var hostContainer = types.NewContainer("host", nil)
+
+// Calls the ink function name with args and returns its result along with
+// any text it output. The story's position and output are left exactly as
+// they were, changes to globals and visit counts are kept
+func (s *Story) EvaluateFunction(name string, args ...any) (result any, text string, err error) {
+	c, i, err := types.ResolvePath(types.Path(name), &s.ink.Root)
+	if err != nil {
+		return nil, "", fmt.Errorf("no function named %s: %w", name, err)
+	}
+	vals := make([]any, 0, len(args))
+	for x, arg := range args {
+		val, err := fromGoValue(arg)
+		if err != nil {
+			return nil, "", fmt.Errorf("argument %d: %w", x, err)
+		}
+		vals = append(vals, val)
+	}
+
+	s.startObserverBatch()
+	defer s.endObserverBatch()
+	defer s.beginRun(s.ctx)()
+	// the function runs against empty stacks which are swapped back out
+	// once it returns, restoring the story as it was
+	flow := s.captureFlow()
+	evaluationStack := s.evaluationStack
+	mode := s.mode
+	stringMarker := s.stringMarker
+	tagMarker := s.tagMarker
+	defer func() {
+		s.loadFlow(flow)
+		s.evaluationStack = evaluationStack
+		s.mode = mode
+		s.stringMarker = stringMarker
+		s.tagMarker = tagMarker
+	}()
+	defer s.recoverRuntimeError(&err)
+
+	s.state.callStack = newCallStack()
+	s.threads = arraystack.New[*Thread]()
+	s.outputBuffer = nil
+	s.evaluationStack = arraystack.New[any]()
+	s.state.currentChoices = []Choice{}
+	s.state.currentTags = []types.Tag{}
+	s.state.outputTags = nil
+	s.state.lines = nil
+	s.state.text = ""
+	s.state.Finished = false
+	s.mode = None
+	s.stringMarker = -1
+	s.tagMarker = -1
+
+	// the function starts with just its args on the evaluation stack so
+	// anything left on it once it returns is the result
+	s.pushFrame(EvaluationFrame, Address{C: hostContainer})
+	for _, val := range vals {
+		s.evaluationStack.Push(val)
+	}
+	s.enterContainer(Address{C: c, I: i})
+	for s.state.callStack.current().Type != RootFrame {
+		if s.state.Finished {
+			return nil, "", s.newRuntimeError(fmt.Sprintf("function %s ended the story", name), nil)
+		}
+		s.reEnterStory()
+		if s.state.IsWaiting() {
+			s.state.waiting = nil
+			return nil, "", s.newRuntimeError(fmt.Sprintf("function %s can't wait on an asynchronous external function", name), nil)
+		}
+		// checked as each choice is made so the error shows where it came from
+		if len(s.state.currentChoices) > 0 {
+			return nil, "", s.newRuntimeError(fmt.Sprintf("function %s can't create choices", name), nil)
+		}
+	}
+
+	text = CleanOutput(outputText(s.outputBuffer))
+	if !s.evaluationStack.Empty() {
+		val, _ := s.evaluationStack.Pop()
+		if _, void := val.(types.VoidVal); !void {
+			result = toGoValue(val)
+		}
+	}
+	log.Debugf("Function %s returned %v", name, result)
+	return result, text, nil
+}
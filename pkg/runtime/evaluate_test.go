@@ -0,0 +1,55 @@
+package runtime
+
+import (
+	"testing"
+
+	"github.com/awwithro/goink/pkg/parser/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvaluateFunction(t *testing.T) {
+	assert := assert.New(t)
+	s, state := startExample(t, "evaluate")
+	assert.Len(state.GetChoices(), 1)
+	address := s.currentAddress
+
+	result, text, err := s.EvaluateFunction("can_afford", 5)
+	assert.NoError(err)
+	assert.Equal(true, result)
+	assert.Equal("", text)
+
+	result, _, err = s.EvaluateFunction("can_afford", 50)
+	assert.NoError(err)
+	assert.Equal(false, result)
+
+	result, text, err = s.EvaluateFunction("shout", "hey")
+	assert.NoError(err)
+	assert.Nil(result)
+	assert.Equal("hey!\n", text)
+	result, _, err = s.EvaluateFunction("can_afford", 10)
+	assert.NoError(err)
+	assert.Equal(false, result, "globals changed by a function are kept")
+
+	_, _, err = s.EvaluateFunction("missing")
+	assert.Error(err)
+	_, _, err = s.EvaluateFunction("can_afford")
+	assert.Error(err, "missing args fail to pop")
+	_, _, err = s.EvaluateFunction("shop")
+	var rErr *RuntimeError
+	if assert.ErrorAs(err, &rErr) {
+		assert.Equal(types.Path("shop.0"), rErr.Path)
+		assert.Len(rErr.CallStack, 1, "the frame EvaluateFunction pushed")
+	}
+
+	// the story carries on from where it was
+	assert.Equal(address, s.currentAddress)
+	assert.True(s.evaluationStack.Empty())
+	assert.Equal(None, s.mode)
+	assert.Len(s.state.GetChoices(), 1)
+	assert.NoError(s.ChoseIndex(0))
+	state, err = s.RunContinuous()
+	assert.NoError(err)
+	txt, _ := state.GetTextAndTags()
+	assert.Equal("Gone\n", txt)
+}
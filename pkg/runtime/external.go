@@ -0,0 +1,312 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"reflect"
+	"slices"
+
+	"github.com/awwithro/goink/pkg/parser/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// An external function as called by the runtime. Args and the result are ink
+// values
+type externalFunction func(args []any) (any, error)
+
+var (
+	errorType    = reflect.TypeOf((*error)(nil)).Elem()
+	listValType  = reflect.TypeOf(types.ListVal{})
+	divertType   = reflect.TypeOf(types.DivertTarget(""))
+	inkValueType = reflect.TypeOf((*any)(nil)).Elem()
+	pendingType  = reflect.TypeOf(&PendingExternal{})
+)
+
+// Returned by an external function that can't answer straight away. The
+// story waits until the host calls ResolveExternal with the handle
+type PendingExternal struct {
+	name string
+}
+
+func NewPendingExternal() *PendingExternal {
+	return &PendingExternal{}
+}
+
+// The name of the external function that's pending
+func (p *PendingExternal) Name() string {
+	return p.name
+}
+
+// Completes the external function the story is waiting on. value is the
+// function's result, nil for no result. An error value stops the story with
+// a RuntimeError the same way a bound func returning an error does
+func (s *Story) ResolveExternal(p *PendingExternal, value any) (err error) {
+	if s.state.waiting == nil {
+		return fmt.Errorf("the story isn't waiting on an external function")
+	}
+	if p != s.state.waiting {
+		return fmt.Errorf("the story is waiting on %s, not the given external function", s.state.waiting.name)
+	}
+	defer s.recoverRuntimeError(&err)
+	s.state.waiting = nil
+	if e, ok := value.(error); ok {
+		panic(s.newRuntimeError(fmt.Sprintf("external function %s failed", p.name), e))
+	}
+	val := any(types.VoidVal{})
+	if value != nil {
+		if val, err = fromGoValue(value); err != nil {
+			s.Panicf("unrecognized result for external func %s: %v", p.name, err)
+		}
+	}
+	s.evaluationStack.Push(val)
+	return nil
+}
+
+// Registers f to be called in place of the ink function name. Args are
+// passed as go values where one exists, otherwise as the ink value
+func (s *Story) RegisterExternalFunction(name string, f func([]any) any) {
+	s.extFuncs[name] = func(args []any) (any, error) {
+		goArgs := make([]any, len(args))
+		for x, arg := range args {
+			goArgs[x] = toGoValue(arg)
+		}
+		return f(goArgs), nil
+	}
+}
+
+// Registers fn to be called in place of the ink function name. fn can be
+// any func whose params and results are bools, numbers, strings, lists or
+// divert targets, for example func(string, int) (bool, error). A non-nil
+// error returned as the last result stops the story with a RuntimeError.
+// Funcs that answer later can return a *PendingExternal
+func (s *Story) BindExternalFunction(name string, fn any) error {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return fmt.Errorf("can't bind %T to %s, it isn't a func", fn, name)
+	}
+	t := v.Type()
+	if t.IsVariadic() {
+		return fmt.Errorf("can't bind %s, variadic funcs aren't supported", name)
+	}
+	for x := 0; x < t.NumIn(); x++ {
+		if !isBindableType(t.In(x)) {
+			return fmt.Errorf("can't bind %s, param %d has unsupported type %s", name, x, t.In(x))
+		}
+	}
+	returnsErr := t.NumOut() > 0 && t.Out(t.NumOut()-1) == errorType
+	values := t.NumOut()
+	if returnsErr {
+		values--
+	}
+	if values > 1 {
+		return fmt.Errorf("can't bind %s, it returns more than one value", name)
+	}
+	if values == 1 && !isBindableType(t.Out(0)) && t.Out(0) != pendingType {
+		return fmt.Errorf("can't bind %s, result has unsupported type %s", name, t.Out(0))
+	}
+
+	s.extFuncs[name] = func(args []any) (any, error) {
+		if len(args) != t.NumIn() {
+			return nil, fmt.Errorf("%s takes %d args but was called with %d", name, t.NumIn(), len(args))
+		}
+		in := make([]reflect.Value, len(args))
+		for x, arg := range args {
+			val, err := toReflectValue(arg, t.In(x))
+			if err != nil {
+				return nil, fmt.Errorf("arg %d of %s: %w", x, name, err)
+			}
+			in[x] = val
+		}
+		out := v.Call(in)
+		if returnsErr {
+			if err, _ := out[len(out)-1].Interface().(error); err != nil {
+				return nil, err
+			}
+		}
+		if values == 0 {
+			return nil, nil
+		}
+		return fromReflectValue(out[0])
+	}
+	return nil
+}
+
+func isBindableType(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return t == listValType || t == inkValueType
+}
+
+// Converts an ink value to the go type a bound func expects. Numbers and
+// bools are coerced the same way the reference runtime coerces them
+func toReflectValue(arg any, t reflect.Type) (reflect.Value, error) {
+	switch t {
+	case listValType, divertType:
+		if reflect.TypeOf(arg) != t {
+			return reflect.Value{}, fmt.Errorf("expected %s but got %T", t, arg)
+		}
+		return reflect.ValueOf(arg), nil
+	case inkValueType:
+		val := toGoValue(arg)
+		if val == nil {
+			return reflect.Zero(t), nil
+		}
+		return reflect.ValueOf(&val).Elem(), nil
+	}
+	val := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.Bool:
+		b, ok := arg.(types.Truthy)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("expected a bool but got %T", arg)
+		}
+		val.SetBool(b.AsBool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := coerceInt(arg)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		val.SetInt(int64(i))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := coerceInt(arg)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if i < 0 {
+			return reflect.Value{}, fmt.Errorf("can't pass %d as an unsigned int", i)
+		}
+		val.SetUint(uint64(i))
+	case reflect.Float32, reflect.Float64:
+		n, ok := arg.(types.NumericVal)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("expected a number but got %T", arg)
+		}
+		val.SetFloat(n.AsFloat())
+	case reflect.String:
+		str, ok := arg.(types.StringVal)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("expected a string but got %T", arg)
+		}
+		val.SetString(string(str))
+	default:
+		return reflect.Value{}, fmt.Errorf("unsupported type %s", t)
+	}
+	return val, nil
+}
+
+// floats are rounded and bools become 0 or 1
+func coerceInt(arg any) (int, error) {
+	switch v := arg.(type) {
+	case types.IntVal:
+		return int(v), nil
+	case types.FloatVal:
+		return int(math.Round(float64(v))), nil
+	case types.BoolVal:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("expected an int but got %T", arg)
+	}
+}
+
+func fromReflectValue(v reflect.Value) (any, error) {
+	if v.Type() == pendingType {
+		if v.IsNil() {
+			return nil, nil
+		}
+		return v.Interface(), nil
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return types.IntVal(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return types.IntVal(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return types.FloatVal(v.Float()), nil
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return fromReflectValue(v.Elem())
+	}
+	return fromGoValue(v.Interface())
+}
+
+// Calls the external function bound to e and pushes its result. Unbound
+// functions fall back to the ink function of the same name
+func (s *Story) callExternalFunction(e types.ExternalFunctionDivert) {
+	f, ok := s.extFuncs[string(e.Path)]
+	if !ok {
+		log.Warnf("External func %s not registered, using fallback", string(e.Path))
+		s.pushStackDivert(e.Divert, FunctionFrame)
+		return
+	}
+	defer s.currentAddress.Increment()
+	args := make([]any, e.Args)
+	for x := e.Args - 1; x >= 0; x-- {
+		args[x] = mustPopStack[any](s.evaluationStack)
+	}
+	res, err := f(args)
+	if err != nil {
+		panic(s.newRuntimeError(fmt.Sprintf("external function %s failed", e.Path), err))
+	}
+	if p, ok := res.(*PendingExternal); ok {
+		// the result is pushed once the host resolves the call
+		log.Debugf("External func %s is pending", e.Path)
+		p.name = string(e.Path)
+		s.state.waiting = p
+		return
+	}
+	if res == nil {
+		log.Debug("No return val from external func, pushing void")
+		s.evaluationStack.Push(types.VoidVal{})
+		return
+	}
+	val, err := fromGoValue(res)
+	if err != nil {
+		s.Panicf("unrecognized return value for external func %s: %v", e.Path, err)
+	}
+	s.evaluationStack.Push(val)
+}
+
+// Checks every external function call in the story can be made, either
+// through a bound func or an ink fallback
+func (s *Story) validateExternalFunctions() error {
+	errs := []error{}
+	visited := map[*types.Container]bool{}
+	var walk func(c *types.Container)
+	walk = func(c *types.Container) {
+		if visited[c] {
+			return
+		}
+		visited[c] = true
+		for x, content := range c.Contents {
+			switch v := content.(type) {
+			case *types.Container:
+				walk(v)
+			case types.ExternalFunctionDivert:
+				if _, ok := s.extFuncs[string(v.Path)]; ok {
+					continue
+				}
+				if _, _, err := types.ResolvePath(v.Path, &s.ink.Root); err == nil {
+					continue
+				}
+				errs = append(errs, fmt.Errorf("external function %s called at %s.%d isn't bound and has no ink fallback", v.Path, c.Path(), x))
+			}
+		}
+		for _, name := range slices.Sorted(maps.Keys(c.SubContainers)) {
+			walk(c.SubContainers[name])
+		}
+	}
+	walk(&s.ink.Root)
+	return errors.Join(errs...)
+}
@@ -0,0 +1,145 @@
+package runtime
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/awwithro/goink/pkg/parser/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// LIST fruit = apple, pear, plum
+// VAR items = (apple, pear)
+// EXTERNAL greet(name, times)
+// EXTERNAL largest(list)
+// EXTERNAL where(target)
+// {greet("Bob", 2)}
+// {largest(items)}
+// {where(-> knot)}
+// -> END
+// == knot ==
+// -> END
+const externalInk = `{"inkVersion":21,"root":[["ev","str","^Bob","/str",2,{"x()":"greet","exArgs":2},"out","/ev","\n","ev",{"VAR?":"items"},{"x()":"largest","exArgs":1},"out","/ev","\n","ev",{"^->":"knot"},{"x()":"where","exArgs":1},"out","/ev","\n","end",null],"done",{"knot":["end",{"#f":1}],"global decl":["ev",{"list":{"fruit.apple":1,"fruit.pear":2}},{"VAR=":"items"},"/ev","end",null],"#f":1}],"listDefs":{"fruit":{"apple":1,"pear":2,"plum":3}}}`
+
+func TestBindExternalFunction(t *testing.T) {
+	assert := assert.New(t)
+	s := NewStory(parseInk(t, []byte(externalInk)))
+	assert.NoError(s.BindExternalFunction("greet", func(name string, times int) (string, error) {
+		return strings.Repeat("Hi "+name+" ", times), nil
+	}))
+	assert.NoError(s.BindExternalFunction("largest", func(l types.ListVal) types.ListVal {
+		return l.Max()
+	}))
+	var target types.DivertTarget
+	assert.NoError(s.BindExternalFunction("where", func(d types.DivertTarget) bool {
+		target = d
+		return true
+	}))
+	assert.NoError(s.Start())
+	state, err := s.RunContinuous()
+	assert.NoError(err)
+	text, _ := state.GetTextAndTags()
+	assert.Equal("Hi Bob Hi Bob\npear\ntrue\n", text)
+	assert.Equal(types.DivertTarget("knot"), target)
+}
+
+func TestBindExternalFunctionError(t *testing.T) {
+	assert := assert.New(t)
+	s := NewStory(parseInk(t, []byte(externalInk)))
+	failed := errors.New("greeter is broken")
+	assert.NoError(s.BindExternalFunction("greet", func(name string, times int) (string, error) {
+		return "", failed
+	}))
+	assert.NoError(s.BindExternalFunction("largest", func(l types.ListVal) {}))
+	assert.NoError(s.BindExternalFunction("where", func(d types.DivertTarget) {}))
+	assert.NoError(s.Start())
+	_, err := s.RunContinuous()
+	var rErr *RuntimeError
+	assert.ErrorAs(err, &rErr)
+	assert.ErrorIs(err, failed)
+}
+
+func TestBindExternalFunctionInvalid(t *testing.T) {
+	s := NewStory(parseInk(t, []byte(externalInk)))
+	testCases := []struct {
+		desc string
+		fn   any
+	}{
+		{desc: "Not a func", fn: 5},
+		{desc: "Unsupported param", fn: func(m map[string]int) {}},
+		{desc: "Unsupported result", fn: func() []int { return nil }},
+		{desc: "Too many results", fn: func() (int, int) { return 0, 0 }},
+		{desc: "Variadic", fn: func(x ...int) {}},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			assert.Error(t, s.BindExternalFunction("greet", tC.fn))
+		})
+	}
+}
+
+func TestMissingExternalFunctions(t *testing.T) {
+	assert := assert.New(t)
+	s := NewStory(parseInk(t, []byte(externalInk)))
+	assert.NoError(s.BindExternalFunction("greet", func(name string, times int) string { return name }))
+	err := s.Start()
+	assert.ErrorContains(err, "external function largest called at 0.11 isn't bound")
+	assert.ErrorContains(err, "external function where called at 0.17 isn't bound")
+	assert.NotContains(err.Error(), "greet")
+}
+
+func TestAsyncExternalFunction(t *testing.T) {
+	assert := assert.New(t)
+	s := NewStory(parseInk(t, []byte(externalInk)))
+	var pending *PendingExternal
+	assert.NoError(s.BindExternalFunction("greet", func(name string, times int) *PendingExternal {
+		pending = NewPendingExternal()
+		return pending
+	}))
+	assert.NoError(s.BindExternalFunction("largest", func(l types.ListVal) types.ListVal { return l.Max() }))
+	assert.NoError(s.BindExternalFunction("where", func(d types.DivertTarget) bool { return true }))
+	assert.NoError(s.Start())
+
+	state, err := s.RunContinuous()
+	assert.NoError(err)
+	assert.True(state.IsWaiting())
+	assert.True(s.IsWaiting())
+	assert.Equal("greet", pending.Name())
+
+	// nothing runs until the call is resolved
+	address := s.currentAddress
+	_, err = s.Step()
+	assert.NoError(err)
+	assert.Equal(address, s.currentAddress)
+	_, err = s.SaveState()
+	assert.Error(err)
+	assert.Error(s.ResolveExternal(NewPendingExternal(), "Hi"))
+
+	assert.NoError(s.ResolveExternal(pending, "Hi Bob"))
+	assert.False(s.IsWaiting())
+	assert.Error(s.ResolveExternal(pending, "Hi Bob"))
+	state, err = s.RunContinuous()
+	assert.NoError(err)
+	text, _ := state.GetTextAndTags()
+	assert.Equal("Hi Bob\npear\ntrue\n", text)
+	assert.True(s.IsFinished())
+}
+
+func TestAsyncExternalFunctionError(t *testing.T) {
+	assert := assert.New(t)
+	s := NewStory(parseInk(t, []byte(externalInk)))
+	pending := NewPendingExternal()
+	s.RegisterExternalFunction("greet", func(args []any) any { return pending })
+	s.RegisterExternalFunction("largest", func(args []any) any { return nil })
+	s.RegisterExternalFunction("where", func(args []any) any { return nil })
+	assert.NoError(s.Start())
+	_, err := s.RunContinuous()
+	assert.NoError(err)
+
+	failed := errors.New("server unavailable")
+	err = s.ResolveExternal(pending, failed)
+	var rErr *RuntimeError
+	assert.ErrorAs(err, &rErr)
+	assert.ErrorIs(err, failed)
+}
@@ -0,0 +1,130 @@
+package runtime
+
+import (
+	"fmt"
+
+	"github.com/awwithro/goink/pkg/parser/types"
+	"github.com/emirpasic/gods/v2/stacks"
+	"github.com/emirpasic/gods/v2/stacks/arraystack"
+	log "github.com/sirupsen/logrus"
+)
+
+// Name of the flow a story starts in
+const DefaultFlowName = "DEFAULT_FLOW"
+
+// A Flow is an independent line of narrative with its own position, call
+// stack, output, choices and temp vars. Global vars, visit counts and turns
+// are shared between all flows of a story
+type Flow struct {
+	name           string
+	currentAddress Address
+	callStack      *CallStack
+	threads        stacks.Stack[*Thread]
+	outputBuffer   []outputItem
+	currentChoices []Choice
+	currentTags    []types.Tag
+	outputTags     []outputTag
+	lines          []Line
+	segments       []Segment
+	text           string
+	done           bool
+	finished       bool
+}
+
+func (s *Story) CurrentFlowName() string {
+	return s.flowName
+}
+
+// Makes name the current flow, creating it if it doesn't exist. A new flow
+// starts at the top of the story
+func (s *Story) SwitchFlow(name string) error {
+	if name == s.flowName {
+		return nil
+	}
+	if s.mode != None {
+		return fmt.Errorf("can't switch flows while in %s mode", s.mode)
+	}
+	next, ok := s.flows[name]
+	if !ok {
+		var err error
+		if next, err = s.newFlow(name); err != nil {
+			return err
+		}
+	}
+	delete(s.flows, name)
+	s.flows[s.flowName] = s.captureFlow()
+	s.loadFlow(next)
+	log.Debug("Switched to flow ", name)
+	return nil
+}
+
+func (s *Story) SwitchToDefaultFlow() error {
+	return s.SwitchFlow(DefaultFlowName)
+}
+
+// Discards the named flow. Removing the current flow switches back to the
+// default flow, which can't be removed
+func (s *Story) RemoveFlow(name string) error {
+	if name == DefaultFlowName {
+		return fmt.Errorf("can't remove the default flow")
+	}
+	if name == s.flowName {
+		if err := s.SwitchToDefaultFlow(); err != nil {
+			return err
+		}
+	}
+	if _, ok := s.flows[name]; !ok {
+		return fmt.Errorf("no flow named %s", name)
+	}
+	delete(s.flows, name)
+	return nil
+}
+
+func (s *Story) newFlow(name string) (*Flow, error) {
+	start, err := s.startAddress()
+	if err != nil {
+		return nil, err
+	}
+	return &Flow{
+		name:           name,
+		currentAddress: start,
+		callStack:      newCallStack(),
+		threads:        arraystack.New[*Thread](),
+		currentChoices: []Choice{},
+	}, nil
+}
+
+// the flow the story is currently running
+func (s *Story) captureFlow() *Flow {
+	return &Flow{
+		name:           s.flowName,
+		currentAddress: s.currentAddress,
+		callStack:      s.state.callStack,
+		threads:        s.threads,
+		outputBuffer:   s.outputBuffer,
+		currentChoices: s.state.currentChoices,
+		currentTags:    s.state.currentTags,
+		outputTags:     s.state.outputTags,
+		lines:          s.state.lines,
+		segments:       s.state.segments,
+		text:           s.state.text,
+		done:           s.state.done,
+		finished:       s.state.Finished,
+	}
+}
+
+func (s *Story) loadFlow(f *Flow) {
+	s.flowName = f.name
+	s.currentAddress = f.currentAddress
+	s.state.callStack = f.callStack
+	s.threads = f.threads
+	s.outputBuffer = f.outputBuffer
+	s.state.currentChoices = f.currentChoices
+	s.state.currentTags = f.currentTags
+	s.state.outputTags = f.outputTags
+	s.state.lines = f.lines
+	s.state.segments = f.segments
+	s.state.text = f.text
+	s.state.done = f.done
+	s.state.Finished = f.finished
+}
@@ -0,0 +1,63 @@
+package runtime
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlows(t *testing.T) {
+	assert := assert.New(t)
+	js, err := os.ReadFile("../../examples/easy.json")
+	assert.NoError(err)
+	ink := parseInk(t, js)
+	s := NewStory(ink)
+	assert.NoError(s.Start())
+	assert.Equal(DefaultFlowName, s.CurrentFlowName())
+
+	state, err := s.RunContinuous()
+	assert.NoError(err)
+	assert.Len(state.GetChoices(), 2)
+
+	// a new flow starts from the top with its own choices
+	assert.NoError(s.SwitchFlow("side"))
+	assert.Equal("side", s.CurrentFlowName())
+	assert.False(s.IsFinished())
+	state, err = s.RunContinuous()
+	assert.NoError(err)
+	txt, _ := state.GetTextAndTags()
+	assert.Equal("Once upon a time...\n", txt)
+	assert.Len(state.GetChoices(), 2)
+	assert.NoError(s.ChoseIndex(1))
+
+	// switching back and forth preserves each flow, even through a save
+	assert.NoError(s.SwitchToDefaultFlow())
+	data, err := s.SaveState()
+	assert.NoError(err)
+	s = NewStory(ink)
+	assert.NoError(s.LoadState(data))
+	assert.Equal(DefaultFlowName, s.CurrentFlowName())
+	assert.NoError(s.ChoseIndex(0))
+	state, err = s.RunContinuous()
+	assert.NoError(err)
+	txt, _ = state.GetTextAndTags()
+	assert.Equal("There were two choices.\nThey lived happily ever after.\n", txt)
+	assert.True(s.IsFinished())
+
+	assert.NoError(s.SwitchFlow("side"))
+	assert.False(s.IsFinished())
+	state, err = s.RunContinuous()
+	assert.NoError(err)
+	txt, _ = state.GetTextAndTags()
+	assert.Equal("There were four lines of content.\nThey lived happily ever after.\n", txt)
+
+	// turns are shared between flows
+	assert.Equal(3, s.state.TurnCount)
+
+	assert.Error(s.RemoveFlow(DefaultFlowName))
+	assert.Error(s.RemoveFlow("missing"))
+	assert.NoError(s.RemoveFlow("side"))
+	assert.Equal(DefaultFlowName, s.CurrentFlowName())
+	assert.Len(s.flows, 0)
+}
@@ -0,0 +1,96 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Bounds on the work a story can do so a story that's stuck in a loop or
+// recursing without end fails instead of hanging. A zero value means no limit
+type Limits struct {
+	// instructions evaluated by a single call to Step or RunContinuous, or
+	// by a run spread over calls to ContinueFor
+	MaxInstructions int
+	// nested function and tunnel calls
+	MaxCallDepth int
+	// values on the evaluation stack
+	MaxEvalStack int
+	// pieces of text waiting to be written to the state
+	MaxOutput int
+}
+
+var (
+	ErrInstructionLimit = errors.New("instruction limit reached")
+	ErrCallDepthLimit   = errors.New("call depth limit reached")
+	ErrEvalStackLimit   = errors.New("evaluation stack limit reached")
+	ErrOutputLimit      = errors.New("output limit reached")
+)
+
+// Limits the work the story can do. Exceeding a limit returns a RuntimeError
+// wrapping one of the Err*Limit errors
+func WithLimits(l Limits) StoryOption {
+	return func(s *Story) {
+		s.limits = l
+	}
+}
+
+// Like Step but stops with the context's error once ctx is done
+func (s *Story) StepContext(ctx context.Context) (StoryState, error) {
+	defer s.beginRun(ctx)()
+	return s.step()
+}
+
+// Like RunContinuous but stops with the context's error once ctx is done
+func (s *Story) RunContinuousContext(ctx context.Context) (state StoryState, err error) {
+	defer s.beginRun(ctx)()
+	s.startObserverBatch()
+	defer s.endObserverBatch()
+	run := true
+	for run {
+		if state, err = s.step(); err != nil {
+			return state, err
+		} else if state.CanContinue() && !state.Finished {
+			continue
+		}
+		run = false
+	}
+	return state, err
+}
+
+// Starts counting instructions against the limits for a call into the
+// story. The returned func puts back whatever run was in progress before
+func (s *Story) beginRun(ctx context.Context) func() {
+	prevCtx, prevInstructions := s.ctx, s.instructions
+	s.ctx, s.instructions = ctx, 0
+	return func() {
+		s.ctx, s.instructions = prevCtx, prevInstructions
+	}
+}
+
+// Called before every instruction is evaluated
+func (s *Story) checkLimits() {
+	if s.ctx != nil {
+		if err := s.ctx.Err(); err != nil {
+			panic(s.newRuntimeError("story evaluation was cancelled", err))
+		}
+	}
+	s.instructions++
+	l := s.limits
+	if l.MaxInstructions > 0 && s.instructions > l.MaxInstructions {
+		s.panicLimit(ErrInstructionLimit, fmt.Sprintf("evaluated more than %d instructions, the story may be stuck in a loop", l.MaxInstructions))
+	}
+	if l.MaxCallDepth > 0 && s.state.callStack.callDepth() > l.MaxCallDepth {
+		s.panicLimit(ErrCallDepthLimit, fmt.Sprintf("calls are nested more than %d deep, a function or tunnel may be recursing without end", l.MaxCallDepth))
+	}
+	if l.MaxEvalStack > 0 && s.evaluationStack.Size() > l.MaxEvalStack {
+		s.panicLimit(ErrEvalStackLimit, fmt.Sprintf("the evaluation stack holds more than %d values", l.MaxEvalStack))
+	}
+	if l.MaxOutput > 0 && len(s.outputBuffer) > l.MaxOutput {
+		s.panicLimit(ErrOutputLimit, fmt.Sprintf("more than %d pieces of text were output without a choice or end", l.MaxOutput))
+	}
+}
+
+func (s *Story) panicLimit(err error, msg string) {
+	panic(s.newRuntimeError(msg, err))
+}
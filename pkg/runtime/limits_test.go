@@ -0,0 +1,78 @@
+package runtime
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimits(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		js       string
+		limits   Limits
+		expected error
+	}{
+		{
+			// == loop ==
+			// -> loop
+			desc:     "Endless divert",
+			js:       `{"inkVersion":21,"root":[[{"->":"loop"},null],"done",{"loop":[{"->":"loop"},{"#f":1}],"#f":1}],"listDefs":{}}`,
+			limits:   Limits{MaxInstructions: 1000},
+			expected: ErrInstructionLimit,
+		},
+		{
+			// == function rec ==
+			// ~ rec()
+			desc:     "Endless recursion",
+			js:       `{"inkVersion":21,"root":[["ev",{"f()":"rec"},"pop","/ev","done",null],"done",{"rec":["ev",{"f()":"rec"},"pop","/ev",{"#f":1}],"#f":1}],"listDefs":{}}`,
+			limits:   Limits{MaxCallDepth: 50},
+			expected: ErrCallDepthLimit,
+		},
+		{
+			desc:     "Growing evaluation stack",
+			js:       `{"inkVersion":21,"root":[[{"->":"loop"},null],"done",{"loop":["ev",1,"/ev",{"->":"loop"},{"#f":1}],"#f":1}],"listDefs":{}}`,
+			limits:   Limits{MaxEvalStack: 100},
+			expected: ErrEvalStackLimit,
+		},
+		{
+			desc:     "Endless output",
+			js:       `{"inkVersion":21,"root":[[{"->":"loop"},null],"done",{"loop":["^x",{"->":"loop"},{"#f":1}],"#f":1}],"listDefs":{}}`,
+			limits:   Limits{MaxOutput: 100},
+			expected: ErrOutputLimit,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			s := NewStory(parseInk(t, []byte(tC.js)), WithLimits(tC.limits))
+			assert.NoError(t, s.Start())
+			_, err := s.RunContinuous()
+			var rErr *RuntimeError
+			assert.ErrorAs(t, err, &rErr)
+			assert.ErrorIs(t, err, tC.expected)
+		})
+	}
+}
+
+func TestRunContinuousContext(t *testing.T) {
+	assert := assert.New(t)
+	js := `{"inkVersion":21,"root":[[{"->":"loop"},null],"done",{"loop":[{"->":"loop"},{"#f":1}],"#f":1}],"listDefs":{}}`
+	s := NewStory(parseInk(t, []byte(js)))
+	assert.NoError(s.Start())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := s.StepContext(ctx)
+	assert.ErrorIs(err, context.Canceled)
+	_, err = s.RunContinuousContext(ctx)
+	assert.ErrorIs(err, context.Canceled)
+
+	// the budget applies to each call rather than the life of the story
+	s = NewStory(parseInk(t, []byte(js)), WithLimits(Limits{MaxInstructions: 10}))
+	assert.NoError(s.Start())
+	for x := 0; x < 20; x++ {
+		_, err = s.Step()
+		assert.NoError(err)
+	}
+}
@@ -0,0 +1,46 @@
+package runtime
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const listOpsText = `true
+true
+true
+true
+true
+one, two, three, four
+one, two, three, four
+three, four
+two, three
+one, two
+four
+two, three
+false
+true
+`
+
+func TestListOperations(t *testing.T) {
+	assert := assert.New(t)
+	ink := loadExample(t, "list_operations")
+	s := NewStory(ink)
+	assert.NoError(s.Start())
+	state, err := s.RunContinuous()
+	assert.NoError(err)
+	text, _ := state.GetTextAndTags()
+	assert.Equal(listOpsText, text)
+
+	// an empty list keeps its origins through a save
+	s = NewStory(ink)
+	assert.NoError(s.Start())
+	saved, err := s.SaveState()
+	assert.NoError(err)
+	loaded := NewStory(ink)
+	assert.NoError(loaded.LoadState(saved))
+	state, err = loaded.RunContinuous()
+	assert.NoError(err)
+	text, _ = state.GetTextAndTags()
+	assert.Equal(listOpsText, text)
+}
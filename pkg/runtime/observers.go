@@ -0,0 +1,62 @@
+package runtime
+
+import (
+	log "github.com/sirupsen/logrus"
+)
+
+// Called with the value of a global var before and after it changed.
+// Ink values are converted to their go equivalents where one exists
+type VariableObserver func(name string, old, new any)
+
+// Registers f to be called whenever the global var name changes value
+func (s *Story) ObserveVariable(name string, f VariableObserver) {
+	s.observers[name] = append(s.observers[name], f)
+}
+
+// Registers f to be called whenever any global var changes value
+func (s *Story) ObserveAllVariables(f VariableObserver) {
+	s.allObservers = append(s.allObservers, f)
+}
+
+// Assigning a var the value it already holds doesn't notify observers
+func (s *Story) setGlobalVar(name string, val any) {
+	if sameValue(s.state.globalVars[name], val) {
+		return
+	}
+	if _, ok := s.changedVars[name]; !ok {
+		s.changedVars[name] = s.state.globalVars[name]
+		s.changedOrder = append(s.changedOrder, name)
+	}
+	s.state.globalVars[name] = val
+}
+
+// Changes are batched while the story runs so observers only see
+// the final value of a var once the batch ends
+func (s *Story) startObserverBatch() {
+	s.observerBatch++
+}
+
+func (s *Story) endObserverBatch() {
+	s.observerBatch--
+	if s.observerBatch > 0 {
+		return
+	}
+	changed := s.changedOrder
+	oldVals := s.changedVars
+	s.changedOrder = nil
+	s.changedVars = map[string]any{}
+	for _, name := range changed {
+		if sameValue(oldVals[name], s.state.globalVars[name]) {
+			continue
+		}
+		old := toGoValue(oldVals[name])
+		new := toGoValue(s.state.globalVars[name])
+		log.Debugf("Notifying observers of %s: %v -> %v", name, old, new)
+		for _, f := range s.observers[name] {
+			f(name, old, new)
+		}
+		for _, f := range s.allObservers {
+			f(name, old, new)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package runtime
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type observed struct {
+	name     string
+	old, new any
+}
+
+func TestVariableObservers(t *testing.T) {
+	// observers.ink assigns y the value it already holds, which observers don't see
+	testCases := []struct {
+		desc     string
+		example  string
+		step     bool // use Step rather than RunContinuous
+		expected []observed
+	}{
+		{
+			desc:     "Batched in RunContinuous",
+			example:  "observers",
+			expected: []observed{{name: "x", old: 1, new: 3}},
+		},
+		{
+			desc:     "Batched in Step",
+			example:  "observers",
+			step:     true,
+			expected: []observed{{name: "x", old: 1, new: 2}, {name: "x", old: 2, new: 3}},
+		},
+		{
+			desc:     "Assigned by ref",
+			example:  "passbyref",
+			expected: []observed{{name: "foo", old: 1, new: 2}},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			assert := assert.New(t)
+			s := NewStory(loadExample(t, tC.example))
+			actual := []observed{}
+			all := []observed{}
+			s.ObserveVariable(tC.expected[0].name, func(name string, old, new any) {
+				actual = append(actual, observed{name: name, old: old, new: new})
+			})
+			s.ObserveAllVariables(func(name string, old, new any) {
+				all = append(all, observed{name: name, old: old, new: new})
+			})
+			assert.NoError(s.Start())
+			for !s.IsFinished() {
+				var err error
+				if tC.step {
+					_, err = s.Step()
+				} else {
+					_, err = s.RunContinuous()
+				}
+				assert.NoError(err)
+			}
+			assert.Equal(tC.expected, actual)
+			assert.Equal(tC.expected, all)
+		})
+	}
+}
@@ -1,13 +1,18 @@
 package runtime
 
 import (
+	"errors"
 	"math"
-	"math/rand"
+	"strings"
 
 	"github.com/awwithro/goink/pkg/parser/types"
 	log "github.com/sirupsen/logrus"
 )
 
+// Returned as part of a RuntimeError when a story divides by zero or takes
+// the modulus of zero
+var ErrDivideByZero = errors.New("division by zero")
+
 func (s *Story) VisitOperator(op types.Operator) {
 	log.Debugf("Visiting Operator: %d", op)
 	if op.IsUnary() {
@@ -24,11 +29,13 @@ func (s *Story) VisitOperator(op types.Operator) {
 				s.evaluationStack.Push(types.IntVal(v.AsInt()))
 			case types.Float:
 				s.evaluationStack.Push(types.FloatVal(v.AsFloat()))
+			// rounding keeps the type, ints are already whole
 			case types.Floor:
-				s.evaluationStack.Push(types.IntVal(int(math.Floor(v.AsFloat()))))
+				s.evaluationStack.Push(unaryOperator(v, math.Floor))
+			case types.Ceiling:
+				s.evaluationStack.Push(unaryOperator(v, math.Ceil))
 			case types.SeedRandom:
-				// TODO: figure out seeds
-				log.Warnf("Should seed with %d", v.AsInt())
+				s.seedRandom(v.AsInt())
 				s.evaluationStack.Push(types.VoidVal{})
 			default:
 				s.Panicf("Unimplemented Operator: %d for %T", op, val)
@@ -44,7 +51,12 @@ func (s *Story) VisitOperator(op types.Operator) {
 			case types.ListCount:
 				s.evaluationStack.Push(types.IntVal(v.Count()))
 			case types.ListRandom:
-				s.evaluationStack.Push(v.Random())
+				if v.Count() == 0 {
+					// the empty list keeps its origins for LIST_ALL and LIST_INVERT
+					s.evaluationStack.Push(v)
+				} else {
+					s.evaluationStack.Push(v.Random(s.nextRandom()))
+				}
 			case types.ListAll:
 				s.evaluationStack.Push(v.All())
 			case types.ListValue:
@@ -57,9 +69,7 @@ func (s *Story) VisitOperator(op types.Operator) {
 				s.evaluationStack.Push(val)
 				log.Debug("Pushed val ", val)
 			case types.ListInvert:
-				original := v.ToSortedSlice()[0].Parent
-				original.Set = original.Difference(v.Set)
-				s.evaluationStack.Push(original)
+				s.evaluationStack.Push(v.Invert())
 			default:
 				s.Panicf("Unimplemented Operator: %d for %T", op, val)
 			}
@@ -71,6 +81,20 @@ func (s *Story) VisitOperator(op types.Operator) {
 		val2 := mustPopStack[any](s.evaluationStack)
 		val1 := mustPopStack[any](s.evaluationStack)
 		log.Debug("Operating on ", val1, val2)
+		// && and || only look at whether each value is truthy so values of
+		// different types, like a list and a bool, can be mixed
+		if op == types.And || op == types.Or {
+			val1, val2 = truthiness(val1), truthiness(val2)
+		}
+		// other operators cast both values to a single type first. listInt
+		// takes a list name and an int and adding or taking an int from a
+		// list moves its items so neither is coerced
+		if _, isList := val1.(types.ListVal); op != types.ListInt && !(isList && (op == types.Plus || op == types.Minus)) {
+			var err error
+			if val1, val2, err = types.Coerce(val1, val2); err != nil {
+				s.Panic(err.Error())
+			}
+		}
 		switch v1 := val1.(type) {
 		case types.NumericVal:
 			v2, ok := val2.(types.NumericVal)
@@ -78,21 +102,9 @@ func (s *Story) VisitOperator(op types.Operator) {
 				panicInvalidStackType[types.NumericVal](val2, s)
 			}
 			switch op {
-			case types.Plus:
-				s.evaluationStack.Push(binaryNumericOperator(v1, v2, add))
-			case types.Minus:
-				s.evaluationStack.Push(binaryNumericOperator(v1, v2, sub))
-			case types.Multiply:
-				s.evaluationStack.Push(binaryNumericOperator(v1, v2, mult))
-			case types.Divide:
-				s.evaluationStack.Push(binaryNumericOperator(v1, v2, div))
-			case types.Modulus:
-				s.evaluationStack.Push(binaryNumericOperator(v1, v2, mod))
-			// Can Min Max work on lists?
-			case types.Min:
-				s.evaluationStack.Push(binaryNumericOperator(v1, v2, min))
-			case types.Max:
-				s.evaluationStack.Push(binaryNumericOperator(v1, v2, max))
+			case types.Plus, types.Minus, types.Multiply, types.Divide, types.Modulus,
+				types.Min, types.Max, types.Pow:
+				s.evaluationStack.Push(s.arithmetic(op, v1, v2))
 			case types.Equal:
 				s.evaluationStack.Push(binaryComparableOperator(v1, v2, eq))
 			case types.NotEqual:
@@ -110,23 +122,41 @@ func (s *Story) VisitOperator(op types.Operator) {
 			case types.Or:
 				s.evaluationStack.Push(binaryBoolOperator(v1, v2, or))
 			case types.Random:
-				s.evaluationStack.Push(binaryNumericOperator(v1, v2, rnd))
+				s.evaluationStack.Push(s.randomRange(v1.AsInt(), v2.AsInt()))
 			default:
 				s.Panicf("Unimplemented Operator: %d for %T and %T", op, val1, val2)
 			}
 		// Odd case, a string and int are used by listInt to get the position from a list
 		// don't know why a VAR? operator isn't used. NEEDS TO GET THE ORIGINAL GLOBAL DEF
 		case types.StringVal:
-			v2, ok := val2.(types.IntVal)
+			if op == types.ListInt {
+				v2, ok := val2.(types.IntVal)
+				if !ok {
+					panicInvalidStackType[types.IntVal](val2, s)
+				}
+				lst, ok := s.computedLists[v1.String()]
+				if !ok {
+					s.Panicf("listInt referenced an undefined list %s", v1)
+				}
+				// Not Zero Indexed! Values outside the list give an empty list
+				s.evaluationStack.Push(lst.FromInt(v2.AsInt()))
+				break
+			}
+			v2, ok := val2.(types.StringVal)
 			if !ok {
-				panicInvalidStackType[types.IntVal](val2, s)
+				panicInvalidStackType[types.StringVal](val2, s)
 			}
 			switch op {
-			case types.ListInt:
-				lst := s.computedLists[v1.String()]
-				res := lst.GetValue(v2.AsInt())
-				s.evaluationStack.Push(types.NewListVal(res)) // Not Zero Indexed!
-
+			case types.Plus:
+				s.evaluationStack.Push(v1 + v2)
+			case types.Equal:
+				s.evaluationStack.Push(types.BoolVal(v1 == v2))
+			case types.NotEqual:
+				s.evaluationStack.Push(types.BoolVal(v1 != v2))
+			case types.Contains:
+				s.evaluationStack.Push(types.BoolVal(strings.Contains(string(v1), string(v2))))
+			case types.NotContains:
+				s.evaluationStack.Push(types.BoolVal(!strings.Contains(string(v1), string(v2))))
 			default:
 				s.Panicf("Unimplemented Operator: %d for %T and %T", op, val1, val2)
 			}
@@ -135,43 +165,55 @@ func (s *Story) VisitOperator(op types.Operator) {
 			case types.ListVal:
 				switch op {
 				case types.ListIntersect:
-					res := v1.Intersect(v2.Set)
-					s.evaluationStack.Push(types.ListVal{Set: res})
+					s.evaluationStack.Push(v1.Intersection(v2))
 				case types.Contains:
-					s.evaluationStack.Push(types.BoolVal(v1.IsSuperset(v2.Set)))
+					s.evaluationStack.Push(types.BoolVal(v1.Has(v2)))
 				case types.NotContains:
-					s.evaluationStack.Push(types.BoolVal(!v1.IsSuperset(v2.Set)))
+					s.evaluationStack.Push(types.BoolVal(!v1.Has(v2)))
 				case types.Plus:
-					res := v1.Union(v2.Set)
-					s.evaluationStack.Push(types.ListVal{Set: res})
+					s.evaluationStack.Push(v1.Merge(v2))
 				case types.Minus:
-					res := v1.Difference(v2.Set)
-					s.evaluationStack.Push(types.ListVal{Set: res})
+					s.evaluationStack.Push(v1.Without(v2))
 				case types.Equal:
-					s.evaluationStack.Push(types.BoolVal(v1.Set.Equal(v2.Set)))
+					s.evaluationStack.Push(binaryComparableOperator(v1, v2, eq))
+				case types.NotEqual:
+					s.evaluationStack.Push(binaryComparableOperator(v1, v2, neq))
+				case types.LessThan:
+					s.evaluationStack.Push(binaryComparableOperator(v1, v2, lt))
+				case types.LessThanEqual:
+					s.evaluationStack.Push(binaryComparableOperator(v1, v2, lte))
+				case types.GreaterThan:
+					s.evaluationStack.Push(binaryComparableOperator(v1, v2, gt))
+				case types.GreaterThanEqual:
+					s.evaluationStack.Push(binaryComparableOperator(v1, v2, gte))
 				default:
 					s.Panicf("Unimplemented Operator: %d for %T and %T", op, val1, val2)
 				}
 			case types.IntVal:
 				switch op {
 				case types.Plus:
-					if v1.Count() != 1 {
-						s.Panic("Can only increment single value sets")
-					}
-					val := v1.ToSlice()[0]
-					v2 := val2.(types.IntVal)
-					for range v2.AsInt() {
-						val = val.Next
-					}
-					v1.Clear()
-					v1.Add(val)
-					s.evaluationStack.Push(v1)
+					s.evaluationStack.Push(v1.Shift(v2.AsInt()))
+				case types.Minus:
+					s.evaluationStack.Push(v1.Shift(-v2.AsInt()))
 				default:
 					s.Panicf("Unimplemented Operator: %d for %T and %T", op, val1, val2)
 				}
 			default:
 				s.Panicf("no operation implemented for %T an %T", v1, v2)
 			}
+		case types.DivertTarget:
+			v2, ok := val2.(types.DivertTarget)
+			if !ok {
+				panicInvalidStackType[types.DivertTarget](val2, s)
+			}
+			switch op {
+			case types.Equal:
+				s.evaluationStack.Push(types.BoolVal(v1.Equals(v2)))
+			case types.NotEqual:
+				s.evaluationStack.Push(types.BoolVal(v1.NotEquals(v2)))
+			default:
+				s.Panicf("Unimplemented Operator: %d for %T and %T", op, val1, val2)
+			}
 		case types.Truthy:
 			v2, ok := val2.(types.Truthy)
 			if !ok {
@@ -193,11 +235,11 @@ func (s *Story) VisitOperator(op types.Operator) {
 		switch op {
 		case types.ListRange:
 			log.Debug("Running ListRange")
-			max := mustPopStack[types.Inty](s.evaluationStack)
-			min := mustPopStack[types.Inty](s.evaluationStack)
+			max := s.rangeBound(mustPopStack[any](s.evaluationStack), false)
+			min := s.rangeBound(mustPopStack[any](s.evaluationStack), true)
 			lst := mustPopStack[types.ListVal](s.evaluationStack)
-			log.Debugf("Range min: %d max: %d of list %d", min.AsInt(), max.AsInt(), lst.Count())
-			s.evaluationStack.Push(lst.Range(min.AsInt(), max.AsInt()))
+			log.Debugf("Range min: %d max: %d of list %d", min, max, lst.Count())
+			s.evaluationStack.Push(lst.Range(min, max))
 		default:
 			s.Panicf("Missing ternary operation %T", op)
 		}
@@ -205,13 +247,97 @@ func (s *Story) VisitOperator(op types.Operator) {
 	s.currentAddress.Increment()
 }
 
-func binaryNumericOperator(x, y types.NumericVal, f func(x, y float64) float64) types.NumericVal {
-	res := f(x.AsFloat(), y.AsFloat())
-	log.Debugf("Result is: %f", res)
+// Applies an arithmetic operator the way ink does. If either value is a float
+// both are treated as floats, otherwise the operation is done on ints so
+// division truncates. POW always gives a float
+func (s *Story) arithmetic(op types.Operator, x, y types.NumericVal) types.NumericVal {
 	if x.IsFloat() || y.IsFloat() {
-		return types.FloatVal(res)
+		a, b := x.AsFloat(), y.AsFloat()
+		switch op {
+		case types.Plus:
+			return types.FloatVal(a + b)
+		case types.Minus:
+			return types.FloatVal(a - b)
+		case types.Multiply:
+			return types.FloatVal(a * b)
+		case types.Divide:
+			s.checkDivisor(b == 0)
+			return types.FloatVal(a / b)
+		case types.Modulus:
+			s.checkDivisor(b == 0)
+			return types.FloatVal(math.Mod(a, b))
+		case types.Min:
+			return types.FloatVal(math.Min(a, b))
+		case types.Max:
+			return types.FloatVal(math.Max(a, b))
+		case types.Pow:
+			return types.FloatVal(math.Pow(a, b))
+		}
 	}
-	return types.IntVal(res)
+	a, b := x.AsInt(), y.AsInt()
+	switch op {
+	case types.Plus:
+		return types.IntVal(a + b)
+	case types.Minus:
+		return types.IntVal(a - b)
+	case types.Multiply:
+		return types.IntVal(a * b)
+	case types.Divide:
+		s.checkDivisor(b == 0)
+		return types.IntVal(a / b)
+	case types.Modulus:
+		s.checkDivisor(b == 0)
+		return types.IntVal(a % b)
+	case types.Min:
+		if b < a {
+			return types.IntVal(b)
+		}
+		return types.IntVal(a)
+	case types.Max:
+		if b > a {
+			return types.IntVal(b)
+		}
+		return types.IntVal(a)
+	case types.Pow:
+		return types.FloatVal(math.Pow(float64(a), float64(b)))
+	}
+	s.Panicf("Unimplemented Operator: %d for %T and %T", op, x, y)
+	return nil
+}
+
+func (s *Story) checkDivisor(zero bool) {
+	if zero {
+		panic(s.newRuntimeError("attempted to divide by zero", ErrDivideByZero))
+	}
+}
+
+// A bound of LIST_RANGE can be a number or a list. A list gives its lowest
+// item for the min and its highest for the max, an empty one leaves the
+// range open
+func (s *Story) rangeBound(val any, lower bool) int {
+	switch v := val.(type) {
+	case types.ListVal:
+		switch {
+		case v.Count() == 0 && lower:
+			return 0
+		case v.Count() == 0:
+			return math.MaxInt
+		case lower:
+			return v.ToSortedSlice()[0].Value
+		}
+		return v.AsInt()
+	case types.NumericVal:
+		return v.AsInt()
+	}
+	s.Panicf("can't use %T as a bound of a list range", val)
+	return 0
+}
+
+func truthiness(val any) any {
+	if t, ok := val.(types.Truthy); ok {
+		return types.BoolVal(t.AsBool())
+	}
+	return val
 }
 
 func binaryComparableOperator[T any](x, y types.Comparable[T], f func(x, y types.Comparable[T]) bool) types.BoolVal {
@@ -231,21 +357,6 @@ func unaryOperator(x types.NumericVal, f func(x float64) float64) types.NumericV
 	}
 	return types.IntVal(res)
 }
-func mult(x float64, y float64) float64 {
-	return x * y
-}
-func div(x float64, y float64) float64 {
-	return x / y
-}
-func add(x, y float64) float64 {
-	return x + y
-}
-func sub(x, y float64) float64 {
-	return x - y
-}
-func mod(x, y float64) float64 {
-	return float64(int(x) % int(y))
-}
 func eq[T any](x, y types.Comparable[T]) bool {
 	return x.Equals(y.(T))
 }
@@ -279,16 +390,6 @@ func not(x float64) float64 {
 	}
 	return 0
 }
-func min(x, y float64) float64 {
-	return math.Min(x, y)
-}
-func max(x, y float64) float64 {
-	return math.Max(x, y)
-}
 func negate(x float64) float64 {
 	return x * -1
 }
-
-func rnd(min, max float64) float64 {
-	return float64(rand.Intn(int(max)+1-int(min)) + int(min))
-}
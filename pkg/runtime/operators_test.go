@@ -68,7 +68,13 @@ func Test(t *testing.T) {
 			desc:     "Test Floor",
 			stack:    []types.Acceptor{types.FloatVal(-4.8)},
 			op:       types.Floor,
-			expected: types.IntVal(-5),
+			expected: types.FloatVal(-5),
+		},
+		{
+			desc:     "Test Floor Int",
+			stack:    []types.Acceptor{types.IntVal(-4)},
+			op:       types.Floor,
+			expected: types.IntVal(-4),
 		},
 		{
 			desc:     "Test Int",
@@ -82,6 +88,126 @@ func Test(t *testing.T) {
 			op:       types.Float,
 			expected: types.FloatVal(4.0),
 		},
+		{
+			desc:     "Test Ceiling",
+			stack:    []types.Acceptor{types.FloatVal(-4.8)},
+			op:       types.Ceiling,
+			expected: types.FloatVal(-4),
+		},
+		{
+			desc:     "Test Ceiling Int",
+			stack:    []types.Acceptor{types.IntVal(3)},
+			op:       types.Ceiling,
+			expected: types.IntVal(3),
+		},
+		{
+			desc:     "Test Int Division",
+			stack:    []types.Acceptor{types.IntVal(7), types.IntVal(2)},
+			op:       types.Divide,
+			expected: types.IntVal(3),
+		},
+		{
+			desc:     "Test Large Int Division",
+			stack:    []types.Acceptor{types.IntVal(9007199254740993), types.IntVal(1)},
+			op:       types.Divide,
+			expected: types.IntVal(9007199254740993),
+		},
+		{
+			desc:     "Test Mixed Division",
+			stack:    []types.Acceptor{types.IntVal(7), types.FloatVal(2)},
+			op:       types.Divide,
+			expected: types.FloatVal(3.5),
+		},
+		{
+			desc:     "Test Negative Int Modulus",
+			stack:    []types.Acceptor{types.IntVal(-7), types.IntVal(3)},
+			op:       types.Modulus,
+			expected: types.IntVal(-1),
+		},
+		{
+			desc:     "Test Float Modulus",
+			stack:    []types.Acceptor{types.FloatVal(7.5), types.IntVal(2)},
+			op:       types.Modulus,
+			expected: types.FloatVal(1.5),
+		},
+		{
+			desc:     "Test Int Pow",
+			stack:    []types.Acceptor{types.IntVal(2), types.IntVal(10)},
+			op:       types.Pow,
+			expected: types.FloatVal(1024),
+		},
+		{
+			desc:     "Test Float Pow",
+			stack:    []types.Acceptor{types.FloatVal(9), types.FloatVal(0.5)},
+			op:       types.Pow,
+			expected: types.FloatVal(3),
+		},
+		{
+			desc:     "Test Int Min",
+			stack:    []types.Acceptor{types.IntVal(3), types.IntVal(-2)},
+			op:       types.Min,
+			expected: types.IntVal(-2),
+		},
+		{
+			desc:     "Test String Concatenation",
+			stack:    []types.Acceptor{types.StringVal("foo"), types.StringVal("bar")},
+			op:       types.Plus,
+			expected: types.StringVal("foobar"),
+		},
+		{
+			desc:     "Test String Equals",
+			stack:    []types.Acceptor{types.StringVal("a"), types.StringVal("a")},
+			op:       types.Equal,
+			expected: types.BoolVal(true),
+		},
+		{
+			desc:     "Test String Not Equals",
+			stack:    []types.Acceptor{types.StringVal("a"), types.StringVal("b")},
+			op:       types.NotEqual,
+			expected: types.BoolVal(true),
+		},
+		{
+			desc:     "Test String Contains",
+			stack:    []types.Acceptor{types.StringVal("hello world"), types.StringVal("o w")},
+			op:       types.Contains,
+			expected: types.BoolVal(true),
+		},
+		{
+			desc:     "Test String Not Contains",
+			stack:    []types.Acceptor{types.StringVal("hello"), types.StringVal("z")},
+			op:       types.NotContains,
+			expected: types.BoolVal(true),
+		},
+		{
+			desc:     "Test Int Plus String",
+			stack:    []types.Acceptor{types.IntVal(5), types.StringVal("a")},
+			op:       types.Plus,
+			expected: types.StringVal("5a"),
+		},
+		{
+			desc:     "Test Float Plus String",
+			stack:    []types.Acceptor{types.StringVal("x"), types.FloatVal(1.5)},
+			op:       types.Plus,
+			expected: types.StringVal("x1.5"),
+		},
+		{
+			desc:     "Test Int Equals Float",
+			stack:    []types.Acceptor{types.IntVal(1), types.FloatVal(1)},
+			op:       types.Equal,
+			expected: types.BoolVal(true),
+		},
+		{
+			desc:     "Test Bool Plus Int",
+			stack:    []types.Acceptor{types.BoolVal(true), types.IntVal(2)},
+			op:       types.Plus,
+			expected: types.IntVal(3),
+		},
+		{
+			desc:     "Test Int Not Equals Bool",
+			stack:    []types.Acceptor{types.IntVal(1), types.BoolVal(true)},
+			op:       types.NotEqual,
+			expected: types.BoolVal(false),
+		},
 	}
 	for _, tC := range testCases {
 		t.Run(tC.desc, func(t *testing.T) {
@@ -97,3 +223,43 @@ func Test(t *testing.T) {
 		})
 	}
 }
+
+func TestDivideByZero(t *testing.T) {
+	testCases := []struct {
+		desc string
+		js   string
+	}{
+		{
+			// {1 / 0}
+			desc: "Int division",
+			js:   `{"inkVersion":21,"root":[["ev",1,0,"/","out","/ev","\n","done",null],"done",{"#f":1}],"listDefs":{}}`,
+		},
+		{
+			// {1.5 % 0}
+			desc: "Float modulus",
+			js:   `{"inkVersion":21,"root":[["ev",1.5,0,"%","out","/ev","\n","done",null],"done",{"#f":1}],"listDefs":{}}`,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			s := NewStory(parseInk(t, []byte(tC.js)))
+			assert.NoError(t, s.Start())
+			_, err := s.RunContinuous()
+			var rErr *RuntimeError
+			assert.ErrorAs(t, err, &rErr)
+			assert.ErrorIs(t, err, ErrDivideByZero)
+		})
+	}
+}
+
+func TestPowAndCeiling(t *testing.T) {
+	// {POW(2, 3)} {CEILING(1.2)} {CEILING(2.5) / 2} {FLOOR(5) / 2}
+	js := `{"inkVersion":21,"root":[["ev",2,3,"POW","out","/ev","^ ","ev",1.2,"CEILING","out","/ev","^ ","ev",2.5,"CEILING",2,"/","out","/ev","^ ","ev",5,"FLOOR",2,"/","out","/ev","\n","done",null],"done",{"#f":1}],"listDefs":{}}`
+	assert := assert.New(t)
+	s := NewStory(parseInk(t, []byte(js)))
+	assert.NoError(s.Start())
+	state, err := s.RunContinuous()
+	assert.NoError(err)
+	text, _ := state.GetTextAndTags()
+	assert.Equal("8 2 1.5 2\n", text)
+}
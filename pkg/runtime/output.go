@@ -0,0 +1,322 @@
+package runtime
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/awwithro/goink/pkg/parser/types"
+)
+
+// An entry in the output buffer. Glue stays in the buffer until text that
+// isn't whitespace follows it, dropping any newlines written in between
+type outputItem struct {
+	text     string
+	glue     bool
+	glued    bool    // the text removed glue written before it
+	function bool    // written while a function was being called
+	source   Address // the content that wrote the text
+}
+
+// A Segment is a piece of output along with where it came from. Joining the
+// text of the segments gives the output before it's cleaned up
+type Segment struct {
+	Text string
+	// path of the content that wrote the text
+	Path types.Path
+	// tags written on the line before the text
+	Tags []types.Tag
+	// joined onto the text before it by glue
+	Glue bool
+	// written by a function call
+	Function bool
+}
+
+func (o outputItem) isNewline() bool {
+	return !o.glue && o.text == "\n"
+}
+
+func (o outputItem) isInlineWhitespace() bool {
+	return !o.glue && strings.Trim(o.text, " \t") == ""
+}
+
+func (o outputItem) isNonWhitespace() bool {
+	return !o.glue && !o.isNewline() && !o.isInlineWhitespace()
+}
+
+// Joins the text of the items, leaving out glue
+func outputText(items []outputItem) string {
+	sb := strings.Builder{}
+	for _, item := range items {
+		sb.WriteString(item.text)
+	}
+	return sb.String()
+}
+
+// Writes text to the output following the same rules as the reference
+// runtime: newlines are dropped after glue, at the start of a function call
+// and when they would duplicate a newline or lead the output
+func (s *Story) pushOutput(text string) {
+	function := s.inFunction()
+	for _, part := range splitHeadTailWhitespace(text) {
+		s.pushOutputItem(outputItem{text: part, function: function, source: s.currentAddress})
+	}
+}
+
+func (s *Story) pushGlue() {
+	s.trimNewlinesFromOutput()
+	s.outputBuffer = append(s.outputBuffer, outputItem{glue: true})
+}
+
+func (s *Story) pushOutputItem(item outputItem) {
+	functionTrim := s.functionOutputStart()
+	glueTrim := -1
+	for x := len(s.outputBuffer) - 1; x >= s.outputBarrier(); x-- {
+		if s.outputBuffer[x].glue {
+			glueTrim = x
+			break
+		}
+	}
+	// a string started within the function isn't trimmed by the function
+	if glueTrim == -1 && s.stringMarker >= 0 && s.stringMarker >= functionTrim {
+		functionTrim = -1
+	}
+
+	if glueTrim != -1 || functionTrim != -1 {
+		if item.isNewline() {
+			return
+		}
+		if item.isNonWhitespace() {
+			if glueTrim != -1 {
+				s.removeExistingGlue()
+				item.glued = true
+			}
+			if functionTrim != -1 {
+				s.clearFunctionOutputStarts()
+			}
+		}
+	} else if item.isNewline() && (s.outputEndsInNewline() || !s.outputContainsContent()) {
+		return
+	}
+	s.outputBuffer = append(s.outputBuffer, item)
+}
+
+// Splits newlines at the start and end of text into their own items so glue
+// can remove them. Runs of newlines become a single newline and the
+// whitespace between them is dropped. Newlines inside the text are left as is
+func splitHeadTailWhitespace(text string) []string {
+	headFirst, headLast := -1, -1
+	for x := 0; x < len(text); x++ {
+		c := text[x]
+		if c == '\n' {
+			if headFirst == -1 {
+				headFirst = x
+			}
+			headLast = x
+		} else if c != ' ' && c != '\t' {
+			break
+		}
+	}
+	tailFirst, tailLast := -1, -1
+	for x := len(text) - 1; x >= 0; x-- {
+		c := text[x]
+		if c == '\n' {
+			if tailLast == -1 {
+				tailLast = x
+			}
+			tailFirst = x
+		} else if c != ' ' && c != '\t' {
+			break
+		}
+	}
+	if headFirst == -1 && tailLast == -1 {
+		return []string{text}
+	}
+
+	parts := []string{}
+	innerStart, innerEnd := 0, len(text)
+	if headFirst != -1 {
+		if headFirst > 0 {
+			parts = append(parts, text[:headFirst])
+		}
+		parts = append(parts, "\n")
+		innerStart = headLast + 1
+	}
+	if tailLast != -1 {
+		innerEnd = tailFirst
+	}
+	if innerEnd > innerStart {
+		parts = append(parts, text[innerStart:innerEnd])
+	}
+	if tailLast != -1 && tailFirst > headLast {
+		parts = append(parts, "\n")
+		if tailLast < len(text)-1 {
+			parts = append(parts, text[tailLast+1:])
+		}
+	}
+	return parts
+}
+
+// Index of the first item written by the string or tag being evaluated.
+// Trimming never reaches back past it
+func (s *Story) outputBarrier() int {
+	barrier := 0
+	if s.stringMarker > barrier {
+		barrier = s.stringMarker
+	}
+	if s.tagMarker > barrier {
+		barrier = s.tagMarker
+	}
+	return barrier
+}
+
+// Where the output of the function being evaluated starts. -1 if we aren't
+// in a function or it's already written text
+func (s *Story) functionOutputStart() int {
+	frame := s.state.callStack.current()
+	if frame.Type != FunctionFrame {
+		return -1
+	}
+	return frame.outputStart
+}
+
+// True if a function is on the call stack
+func (s *Story) inFunction() bool {
+	for _, frame := range s.state.callStack.frames {
+		if frame.Type == FunctionFrame {
+			return true
+		}
+	}
+	return false
+}
+
+// Once a function writes text, it and the functions that called it no longer
+// trim whitespace from the start of their output
+func (s *Story) clearFunctionOutputStarts() {
+	frames := s.state.callStack.frames
+	for x := len(frames) - 1; x >= 0 && frames[x].Type == FunctionFrame; x-- {
+		frames[x].outputStart = -1
+	}
+}
+
+func (s *Story) outputEndsInNewline() bool {
+	for x := len(s.outputBuffer) - 1; x >= s.outputBarrier(); x-- {
+		item := s.outputBuffer[x]
+		if item.isNewline() {
+			return true
+		}
+		if item.isNonWhitespace() {
+			break
+		}
+	}
+	return false
+}
+
+func (s *Story) outputContainsContent() bool {
+	for _, item := range s.outputBuffer {
+		if !item.glue {
+			return true
+		}
+	}
+	return false
+}
+
+// Removes the whitespace at the end of the output from its first newline on
+func (s *Story) trimNewlinesFromOutput() {
+	removeFrom := -1
+	for x := len(s.outputBuffer) - 1; x >= s.outputBarrier(); x-- {
+		item := s.outputBuffer[x]
+		if item.isNonWhitespace() {
+			break
+		}
+		if item.isNewline() {
+			removeFrom = x
+		}
+	}
+	if removeFrom == -1 {
+		return
+	}
+	for x := len(s.outputBuffer) - 1; x >= removeFrom; x-- {
+		if !s.outputBuffer[x].glue {
+			s.removeOutput(x)
+		}
+	}
+}
+
+func (s *Story) removeExistingGlue() {
+	for x := len(s.outputBuffer) - 1; x >= s.outputBarrier(); x-- {
+		if s.outputBuffer[x].glue {
+			s.removeOutput(x)
+		}
+	}
+}
+
+// Drops whitespace from the end of a function's output before it returns
+func (s *Story) trimFunctionEnd() {
+	start := s.functionOutputStart()
+	if start == -1 {
+		start = 0
+	}
+	for x := len(s.outputBuffer) - 1; x >= start; x-- {
+		item := s.outputBuffer[x]
+		if item.glue {
+			continue
+		}
+		if !item.isNewline() && !item.isInlineWhitespace() {
+			break
+		}
+		s.removeOutput(x)
+	}
+}
+
+// Removes a single item, keeping tags attached to the items around it
+func (s *Story) removeOutput(x int) {
+	s.outputBuffer = append(s.outputBuffer[:x], s.outputBuffer[x+1:]...)
+	for t := range s.state.outputTags {
+		if s.state.outputTags[t].pos > x {
+			s.state.outputTags[t].pos--
+		}
+	}
+}
+
+// Builds the segments for the items. Glue isn't text so it's left out
+func outputSegments(items []outputItem, tags []outputTag) []Segment {
+	segments := make([]Segment, 0, len(items))
+	lineTags := []types.Tag{}
+	for x, item := range items {
+		for len(tags) > 0 && tags[0].pos <= x {
+			lineTags = append(lineTags, tags[0].tag)
+			tags = tags[1:]
+		}
+		if item.glue {
+			continue
+		}
+		segments = append(segments, item.segment(item.text, lineTags))
+		if strings.Contains(item.text, "\n") {
+			lineTags = []types.Tag{}
+		}
+	}
+	return segments
+}
+
+func (o outputItem) segment(text string, tags []types.Tag) Segment {
+	return Segment{
+		Text:     text,
+		Path:     contentPath(o.source),
+		Tags:     slices.Clone(tags),
+		Glue:     o.glued,
+		Function: o.function,
+	}
+}
+
+// The path of the content at the address
+func contentPath(a Address) types.Path {
+	if a.C == nil {
+		return ""
+	}
+	if p := a.C.Path(); p != "" {
+		return types.Path(fmt.Sprintf("%s.%d", p, a.I))
+	}
+	return types.Path(strconv.Itoa(a.I))
+}
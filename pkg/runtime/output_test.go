@@ -0,0 +1,212 @@
+package runtime
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/awwithro/goink/pkg/parser/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitHeadTailWhitespace(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		input    string
+		expected []string
+	}{
+		{
+			desc:     "No newlines",
+			input:    "Hello world",
+			expected: []string{"Hello world"},
+		},
+		{
+			desc:     "Only a newline",
+			input:    "\n",
+			expected: []string{"\n"},
+		},
+		{
+			desc:     "Leading and trailing newlines",
+			input:    "\n \nHello\n",
+			expected: []string{"\n", "Hello", "\n"},
+		},
+		{
+			desc:     "Spaces around the newlines are kept",
+			input:    "  \nHello\n  ",
+			expected: []string{"  ", "\n", "Hello", "\n", "  "},
+		},
+		{
+			desc:     "Inner newlines are left alone",
+			input:    "Hello\nworld",
+			expected: []string{"Hello\nworld"},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			assert.Equal(t, tC.expected, splitHeadTailWhitespace(tC.input))
+		})
+	}
+}
+
+func TestOutputWhitespace(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		js       string
+		expected string
+	}{
+		{
+			// A <>
+			// B
+			desc:     "Trailing glue",
+			js:       `{"inkVersion":21,"root":[["^A ","<>","\n","^B","\n","done",null],"done",{"#f":1}],"listDefs":{}}`,
+			expected: "A B\n",
+		},
+		{
+			// The
+			// ~ f()
+			// <> end.
+			// == function f ==
+			// middle
+			desc:     "Newlines around function output",
+			js:       `{"inkVersion":21,"root":[["^The ","<>","\n","ev",{"f()":"f"},"pop","/ev","\n","<>","^ end.","\n","done",null],"done",{"f":["\n","^middle","\n",{"#f":1}],"#f":1}],"listDefs":{}}`,
+			expected: "The middle end.\n",
+		},
+		{
+			desc:     "Leading and duplicate newlines",
+			js:       `{"inkVersion":21,"root":[["\n","^A","\n","\n","^B","\n","done",null],"done",{"#f":1}],"listDefs":{}}`,
+			expected: "A\nB\n",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			s := NewStory(parseInk(t, []byte(tC.js)))
+			assert.NoError(t, s.Start())
+			state, err := s.RunContinuous()
+			assert.NoError(t, err)
+			text, _ := state.GetTextAndTags()
+			assert.Equal(t, tC.expected, text)
+		})
+	}
+}
+
+func TestSegments(t *testing.T) {
+	// A
+	// <> B #t
+	// ~ f()
+	// == function f ==
+	// fn
+	js := `{"inkVersion":21,"root":[["^A","\n","<>","^ B ","#","^t","/#","ev",{"f()":"f"},"pop","/ev","\n","done",null],"done",{"f":["^fn","\n",{"#f":1}],"#f":1}],"listDefs":{}}`
+	assert := assert.New(t)
+	s := NewStory(parseInk(t, []byte(js)))
+	assert.NoError(s.Start())
+	state, err := s.RunContinuous()
+	assert.NoError(err)
+
+	assert.Equal([]Segment{
+		{Text: "A", Path: "0.0", Tags: []types.Tag{}},
+		{Text: " B ", Path: "0.3", Tags: []types.Tag{}, Glue: true},
+		{Text: "fn", Path: "f.0", Tags: []types.Tag{"t"}, Function: true},
+		{Text: "\n", Path: "0.11", Tags: []types.Tag{"t"}},
+	}, state.GetSegments())
+	lines := state.GetLines()
+	assert.Len(lines, 1)
+	assert.Equal("A B fn", lines[0].Text)
+	assert.Len(lines[0].Segments, 3)
+
+	text, tags := state.GetTextAndTags()
+	assert.Equal("A B fn\n", text)
+	assert.Equal([]types.Tag{"t"}, tags)
+	assert.Empty(state.GetSegments())
+}
+
+func TestExampleTranscripts(t *testing.T) {
+	testCases := []struct {
+		example string
+		choices []int
+	}{
+		// the long stories always take the first choice until they end. Stories
+		// that use RANDOM or shuffles without seeding themselves are left out
+		{example: "all"},
+		{example: "crimescene", choices: make([]int, 23)},
+		{example: "easy", choices: []int{1}},
+		{example: "expressions"},
+		{example: "externalfunc"},
+		{example: "fallback", choices: []int{0, 0}},
+		{example: "hello", choices: []int{0}},
+		{example: "intercept", choices: make([]int, 27)},
+		{example: "invert"},
+		{example: "list1"},
+		{example: "lists"},
+		{example: "loop", choices: []int{0, 0, 1}},
+		{example: "only-text"},
+		{example: "passbyref"},
+		{example: "passtempvarbyref"},
+		{example: "range"},
+		{example: "seq"},
+		{example: "tag"},
+		{example: "thread", choices: []int{1}},
+		{example: "tunnel_onwards", choices: []int{1, 1, 1, 0, 0}},
+		{example: "vars"},
+		{example: "varsnfuncs"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.example, func(t *testing.T) {
+			js, err := os.ReadFile(filepath.Join("../../examples", tC.example+".json"))
+			assert.NoError(t, err)
+			expected, err := os.ReadFile(filepath.Join("../../examples/transcripts", tC.example+".txt"))
+			assert.NoError(t, err)
+			s := NewStory(parseInk(t, js))
+			s.RegisterExternalFunction("Hello", hello)
+			transcript, err := playTranscript(&s, tC.choices)
+			assert.NoError(t, err)
+			assert.Equal(t, string(expected), transcript)
+		})
+	}
+}
+
+// playTranscript plays a story taking the given choices in order and renders
+// it the way inklecate's play mode does: the text, its tags, the numbered
+// choices and the one picked. It stops when the story ends or runs out of
+// choices to take.
+func playTranscript(s *Story, choices []int) (string, error) {
+	sb := strings.Builder{}
+	if err := s.Start(); err != nil {
+		return "", err
+	}
+	for {
+		state, err := s.RunContinuous()
+		if err != nil {
+			return sb.String(), err
+		}
+		text, tags := state.GetTextAndTags()
+		sb.WriteString(text)
+		if text != "" && !strings.HasSuffix(text, "\n") {
+			sb.WriteString("\n")
+		}
+		if len(tags) > 0 {
+			fmt.Fprintf(&sb, "# tags: %s\n", strings.Join(tagStrings(tags), ", "))
+		}
+		options := state.GetChoices()
+		for i, c := range options {
+			fmt.Fprintf(&sb, "%d: %s\n", i+1, c.ChoiceText())
+		}
+		if s.IsFinished() || len(options) == 0 || len(choices) == 0 {
+			return sb.String(), nil
+		}
+		fmt.Fprintf(&sb, "?> %d\n", choices[0]+1)
+		if err := s.ChoseIndex(choices[0]); err != nil {
+			return sb.String(), err
+		}
+		choices = choices[1:]
+	}
+}
+
+func tagStrings(tags []types.Tag) []string {
+	res := make([]string, len(tags))
+	for i, t := range tags {
+		res[i] = string(t)
+	}
+	return res
+}
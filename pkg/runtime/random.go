@@ -0,0 +1,126 @@
+package runtime
+
+import (
+	"math"
+
+	"github.com/awwithro/goink/pkg/parser/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// inkRandom is a port of the .NET System.Random generator used by the
+// reference ink runtime. Using the same generator means a given seed produces
+// the same RANDOM, shuffle and LIST_RANDOM results as inklecate
+type inkRandom struct {
+	seedArray [56]int32
+	inext     int
+	inextp    int
+}
+
+const (
+	randomMBig  = math.MaxInt32
+	randomMSeed = 161803398
+)
+
+func newInkRandom(seed int32) *inkRandom {
+	r := &inkRandom{}
+	subtraction := seed
+	if seed == math.MinInt32 {
+		subtraction = math.MaxInt32
+	} else if seed < 0 {
+		subtraction = -seed
+	}
+	mj := randomMSeed - subtraction
+	r.seedArray[55] = mj
+	mk := int32(1)
+	for i := 1; i < 55; i++ {
+		ii := (21 * i) % 55
+		r.seedArray[ii] = mk
+		mk = mj - mk
+		if mk < 0 {
+			mk += randomMBig
+		}
+		mj = r.seedArray[ii]
+	}
+	for k := 1; k < 5; k++ {
+		for i := 1; i < 56; i++ {
+			r.seedArray[i] -= r.seedArray[1+(i+30)%55]
+			if r.seedArray[i] < 0 {
+				r.seedArray[i] += randomMBig
+			}
+		}
+	}
+	r.inext = 0
+	r.inextp = 21
+	return r
+}
+
+// Returns a non-negative random int
+func (r *inkRandom) Next() int {
+	r.inext++
+	if r.inext >= 56 {
+		r.inext = 1
+	}
+	r.inextp++
+	if r.inextp >= 56 {
+		r.inextp = 1
+	}
+	ret := r.seedArray[r.inext] - r.seedArray[r.inextp]
+	if ret == randomMBig {
+		ret--
+	}
+	if ret < 0 {
+		ret += randomMBig
+	}
+	r.seedArray[r.inext] = ret
+	return int(ret)
+}
+
+// Each random value seeds the generator for the next one, so the sequence only
+// depends on the story seed and the previous result
+func (s *Story) nextRandom() int {
+	r := newInkRandom(int32(s.state.storySeed + s.state.previousRandom))
+	next := r.Next()
+	s.state.previousRandom = next
+	return next
+}
+
+func (s *Story) seedRandom(seed int) {
+	log.Debug("Seeding random with ", seed)
+	s.state.storySeed = seed
+	s.state.previousRandom = 0
+}
+
+func (s *Story) randomRange(min, max int) types.IntVal {
+	size := max - min + 1
+	if size <= 0 {
+		s.Panicf("RANDOM was called with min %d greater than max %d", min, max)
+	}
+	return types.IntVal(s.nextRandom()%size + min)
+}
+
+// Picks the next index of a shuffle sequence. Each loop through the sequence
+// shuffles the elements using a seed derived from the container, the loop
+// number and the story seed so repeat visits are stable
+func (s *Story) shuffleIndex(numElements, seqCount int) int {
+	loopIndex := seqCount / numElements
+	iterationIndex := seqCount % numElements
+
+	sequenceHash := 0
+	for _, c := range s.currentAddress.C.Path() {
+		sequenceHash += int(c)
+	}
+	r := newInkRandom(int32(sequenceHash + loopIndex + s.state.storySeed))
+	unpicked := make([]int, numElements)
+	for x := range unpicked {
+		unpicked[x] = x
+	}
+	for x := 0; x <= iterationIndex; x++ {
+		chosen := r.Next() % len(unpicked)
+		chosenIndex := unpicked[chosen]
+		unpicked = append(unpicked[:chosen], unpicked[chosen+1:]...)
+		if x == iterationIndex {
+			return chosenIndex
+		}
+	}
+	return 0
+}
@@ -0,0 +1,92 @@
+package runtime
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Values taken from the .NET System.Random used by the reference runtime
+func TestInkRandom(t *testing.T) {
+	testCases := []struct {
+		seed     int32
+		expected []int
+	}{
+		{seed: 0, expected: []int{1559595546, 1755192844}},
+		{seed: 1, expected: []int{534011718, 237820880}},
+		{seed: 42, expected: []int{1434747710, 302596119}},
+	}
+	for _, tC := range testCases {
+		r := newInkRandom(tC.seed)
+		for _, expected := range tC.expected {
+			assert.Equal(t, expected, r.Next())
+		}
+	}
+}
+
+func TestSeededRandomness(t *testing.T) {
+	testCases := []struct {
+		desc            string
+		inkJsonFilePath string
+		seed            int
+		expectedText    string
+	}{
+		{
+			desc:            "Random",
+			inkJsonFilePath: "../../examples/random.json",
+			seed:            1,
+			expectedText:    "1\n",
+		},
+		{
+			desc:            "Random Different Seed",
+			inkJsonFilePath: "../../examples/random.json",
+			seed:            42,
+			expectedText:    "3\n",
+		},
+		{
+			desc:            "Shuffle",
+			inkJsonFilePath: "../../examples/shuffle.json",
+			seed:            0,
+			expectedText:    "I tossed the coin. Heads.\n",
+		},
+		{
+			desc:            "Shuffle Different Seed",
+			inkJsonFilePath: "../../examples/shuffle.json",
+			seed:            3,
+			expectedText:    "I tossed the coin. Tails.\n",
+		},
+		{
+			// picks from the items in the order they were written, an empty
+			// list comes back with its origins
+			desc:            "List Random",
+			inkJsonFilePath: "../../examples/list_random.json",
+			expectedText:    "cherry\napple, banana, cherry\n",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			assert := assert.New(t)
+			js, err := os.ReadFile(tC.inkJsonFilePath)
+			assert.NoError(err)
+			s := NewStory(parseInk(t, js), WithSeed(tC.seed))
+			assert.NoError(s.Start())
+			state, err := s.RunContinuous()
+			assert.NoError(err)
+			txt, _ := state.GetTextAndTags()
+			assert.Equal(tC.expectedText, txt)
+		})
+	}
+}
+
+func TestSeedRandom(t *testing.T) {
+	assert := assert.New(t)
+	js, err := os.ReadFile("../../examples/seed.json")
+	assert.NoError(err)
+	s := NewStory(parseInk(t, js))
+	assert.NoError(s.Start())
+	_, err = s.RunContinuous()
+	assert.NoError(err)
+	assert.Equal(12, s.state.storySeed)
+	assert.Equal(0, s.state.previousRandom)
+}
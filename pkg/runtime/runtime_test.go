@@ -2,6 +2,7 @@ package runtime
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/awwithro/goink/pkg/parser"
@@ -65,8 +66,8 @@ func TestFullInkStory(t *testing.T) {
 		},
 		{
 			desc:            "Complex lists",
-			inkJsonFilePath: "../../examples/list2.json",
-			expectedText: `three,six
+			inkJsonFilePath: "../../examples/lists.json",
+			expectedText: `three, six
 true
 get the representation of a list object: one
 two
@@ -81,17 +82,17 @@ four
 		{
 			desc:            "List All Func",
 			inkJsonFilePath: "../../examples/all.json",
-			expectedText:    "a,f\na,e,b,f,c,g,d,h,e,i,j\n",
+			expectedText:    "a, f\na, e, b, f, c, g, d, h, e, i, j\n",
 		},
 		{
 			desc:            "Range Func",
 			inkJsonFilePath: "../../examples/range.json",
-			expectedText:    "b,c,d\n",
+			expectedText:    "b, c, d\n",
 		},
 		{
 			desc:            "List Invert Func",
 			inkJsonFilePath: "../../examples/invert.json",
-			expectedText:    "Pre: Smith,Jones\nPost: Carter,Braithwaite\n",
+			expectedText:    "Pre: Smith, Jones\nPost: Carter, Braithwaite\n",
 		},
 		{
 			desc:            "Sequence",
@@ -102,7 +103,7 @@ four
 			desc:            "Tags",
 			inkJsonFilePath: "../../examples/tag.json",
 			expectedText:    "Hello\n",
-			expectedTags:    []types.Tag{types.Tag("world "), types.Tag("another")},
+			expectedTags:    []types.Tag{types.Tag("world"), types.Tag("another")},
 		},
 		{
 			desc:            "Vars and ref Funcs",
@@ -117,7 +118,42 @@ four
 		{
 			desc:            "Pass Temp var by Ref",
 			inkJsonFilePath: "../../examples/passtempvarbyref.json",
-			expectedText:    "initial x 1\nbar var 2\nbarref var 3\n",
+			expectedText:    "initial x 1\nbar var 2\nbarref var 3\nfinal x 3\n",
+		},
+		{
+			desc:            "Threads First Thread",
+			inkJsonFilePath: "../../examples/thread.json",
+			choices:         []int{0},
+			choiceCounts:    []int{3},
+			expectedText:    "\"What did you have for lunch today?\" I asked.\n\"Spam and eggs,\" he replied.\nBefore long, we arrived at his house.\n",
+		},
+		{
+			desc:            "Threads Second Thread",
+			inkJsonFilePath: "../../examples/thread.json",
+			choices:         []int{1},
+			choiceCounts:    []int{3},
+			expectedText:    "\"Nice weather, we're having,\" I said.\n\"I've seen better,\" he replied.\nBefore long, we arrived at his house.\n",
+		},
+		{
+			desc:            "Threads Continue Walking",
+			inkJsonFilePath: "../../examples/thread.json",
+			choices:         []int{2},
+			choiceCounts:    []int{3},
+			expectedText:    "Before long, we arrived at his house.\n",
+		},
+		{
+			desc:            "Tunnel Onwards From A Nested Tunnel",
+			inkJsonFilePath: "../../examples/tunnel_onwards.json",
+			choices:         []int{1, 3},
+			choiceCounts:    []int{5, 4},
+			expectedText:    "You leave the house.\n",
+		},
+		{
+			desc:            "Chained Tunnels",
+			inkJsonFilePath: "../../examples/tunnel_onwards.json",
+			choices:         []int{0, 3},
+			choiceCounts:    []int{5, 4},
+			expectedText:    "You leave the house.\n",
 		},
 	}
 	parsed := map[string]types.Ink{}
@@ -134,7 +170,7 @@ four
 			if ink, ok = parsed[tC.inkJsonFilePath]; !ok {
 				js, err := os.ReadFile(tC.inkJsonFilePath)
 				assert.NoError(err)
-				ink = parser.Parse(js)
+				ink = parseInk(t, js)
 				parsed[tC.inkJsonFilePath] = ink
 			}
 			s := NewStory(ink)
@@ -145,7 +181,7 @@ four
 					s.RegisterExternalFunction(k, v)
 				}
 			}
-			s.Start()
+			assert.NoError(s.Start())
 			choiceIdx := 0
 			var state StoryState
 			var err error
@@ -169,6 +205,68 @@ four
 	}
 }
 
+// each thread adds its text and choices before the story waits for a choice
+func TestThreadsOpening(t *testing.T) {
+	assert := assert.New(t)
+	js, err := os.ReadFile("../../examples/thread.json")
+	assert.NoError(err)
+	s := NewStory(parseInk(t, js))
+	assert.NoError(s.Start())
+	state, err := s.RunContinuous()
+	assert.NoError(err)
+	text, _ := state.GetTextAndTags()
+	assert.Equal("I had a headache; threading is hard to get your head around.\nIt was a tense moment for Monty and me.\nWe continued to walk down the dusty road.\n", text)
+	choices := []string{}
+	for _, c := range state.GetChoices() {
+		choices = append(choices, c.ChoiceText())
+	}
+	assert.Equal([]string{"\"What did you have for lunch today?\"", "\"Nice weather, we're having,\"", "Continue walking"}, choices)
+}
+
+// every thread offers its choice even when it finishes inside a tunnel
+func TestThreadCallingTunnel(t *testing.T) {
+	assert := assert.New(t)
+	_, state := startExample(t, "thread_tunnel")
+	choices := []string{}
+	for _, c := range state.GetChoices() {
+		choices = append(choices, c.ChoiceText())
+	}
+	assert.Equal([]string{"Open the left door", "Open the middle door", "Open the right door"}, choices)
+}
+
+// loads a compiled story from examples/, name is the file without .json
+func loadExample(t *testing.T, name string) types.Ink {
+	t.Helper()
+	js, err := os.ReadFile(filepath.Join("../../examples", name+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parseInk(t, js)
+}
+
+// starts a compiled story from examples/ and runs it to its first stop
+func startExample(t *testing.T, name string, opts ...StoryOption) (*Story, StoryState) {
+	t.Helper()
+	s := NewStory(loadExample(t, name), opts...)
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	state, err := s.RunContinuous()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &s, state
+}
+
+func parseInk(t *testing.T, js []byte) types.Ink {
+	t.Helper()
+	ink, err := parser.Parse(js)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ink
+}
+
 func hello(x []any) any {
 	return "External Hello " + x[0].(string)
 }
@@ -0,0 +1,564 @@
+package runtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/awwithro/goink/pkg/parser/types"
+	"github.com/emirpasic/gods/v2/stacks/arraystack"
+)
+
+// Containers are saved by their path so a save can be loaded against
+// a freshly parsed copy of the same story
+type savedAddress struct {
+	Path  types.Path `json:"path"`
+	Index int        `json:"index"`
+}
+
+type savedValue struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+type savedPointer struct {
+	Name         string `json:"name"`
+	ContextIndex int    `json:"ci"`
+}
+
+// Where a thread is running
+type savedState struct {
+	Mode    Mode          `json:"mode"`
+	Address *savedAddress `json:"address"`
+}
+
+type savedFrame struct {
+	Type        FrameType             `json:"type"`
+	Return      *savedAddress         `json:"return,omitempty"`
+	ReturnMode  Mode                  `json:"returnMode,omitempty"`
+	OutputStart int                   `json:"outputStart,omitempty"`
+	Temps       map[string]savedValue `json:"temps"`
+}
+
+type savedThread struct {
+	Current savedState   `json:"current"`
+	Frames  []savedFrame `json:"frames"`
+}
+
+type savedOutput struct {
+	Text     string        `json:"text,omitempty"`
+	Glue     bool          `json:"glue,omitempty"`
+	Glued    bool          `json:"glued,omitempty"`
+	Function bool          `json:"function,omitempty"`
+	Source   *savedAddress `json:"source,omitempty"`
+}
+
+type savedOutputTag struct {
+	Tag types.Tag `json:"tag"`
+	Pos int       `json:"pos"`
+}
+
+type savedChoice struct {
+	Text           string       `json:"text"`
+	ChoiceOnlyText string       `json:"choiceOnlyText"`
+	Destination    savedAddress `json:"destination"`
+	OnlyDefault    bool         `json:"onlyDefault"`
+	Tags           []types.Tag  `json:"tags,omitempty"`
+	Thread         *savedThread `json:"thread"`
+}
+
+// The parts of the story that belong to a single flow
+type savedFlow struct {
+	CurrentChoices []savedChoice    `json:"currentChoices"`
+	CurrentTags    []types.Tag      `json:"currentTags"`
+	OutputTags     []savedOutputTag `json:"outputTags,omitempty"`
+	Lines          []Line           `json:"lines,omitempty"`
+	Segments       []Segment        `json:"segments,omitempty"`
+	Done           bool             `json:"done"`
+	Finished       bool             `json:"finished"`
+	Text           string           `json:"text"`
+	OutputBuffer   []savedOutput    `json:"outputBuffer"`
+	Current        savedState       `json:"current"`
+	Frames         []savedFrame     `json:"frames"`
+	Threads        []savedThread    `json:"threads"`
+}
+
+type savedStory struct {
+	savedFlow
+	FlowName        string                `json:"flowName"`
+	Flows           map[string]savedFlow  `json:"flows"` // every flow other than the current one
+	GlobalVars      map[string]savedValue `json:"globalVars"`
+	VisitCounts     map[types.Path]int    `json:"visitCounts"`
+	LastTurn        map[types.Path]int    `json:"lastTurn"`
+	TurnCount       int                   `json:"turnCount"`
+	StorySeed       int                   `json:"storySeed"`
+	PreviousRandom  int                   `json:"previousRandom"`
+	EvaluationStack []savedValue          `json:"evaluationStack"` // bottom of the stack first
+	StringMarker    int                   `json:"stringMarker"`
+	TagMarker       int                   `json:"tagMarker"`
+}
+
+// Serializes the full state of the story. The story can be resumed by calling
+// LoadState on a new Story created from the same ink
+func (s *Story) SaveState() ([]byte, error) {
+	if s.state.IsWaiting() {
+		return nil, fmt.Errorf("can't save while waiting on external function %s", s.state.waiting.name)
+	}
+	e := stateEncoder{listNames: map[*types.ListValItem]string{}, originNames: map[*types.ListVal]string{}}
+	for name, lst := range s.computedLists {
+		for _, origin := range lst.Origins {
+			e.originNames[origin] = name
+		}
+		for _, item := range lst.ToSlice() {
+			e.listNames[item] = fmt.Sprintf("%s.%s", name, item.Name)
+		}
+	}
+	saved := savedStory{
+		FlowName:       s.flowName,
+		Flows:          map[string]savedFlow{},
+		VisitCounts:    map[types.Path]int{},
+		LastTurn:       map[types.Path]int{},
+		TurnCount:      s.state.TurnCount,
+		StorySeed:      s.state.storySeed,
+		PreviousRandom: s.state.previousRandom,
+		StringMarker:   s.stringMarker,
+		TagMarker:      s.tagMarker,
+	}
+	var err error
+	if saved.savedFlow, err = e.encodeFlow(s.captureFlow(), s.mode); err != nil {
+		return nil, err
+	}
+	for name, f := range s.flows {
+		if saved.Flows[name], err = e.encodeFlow(f, None); err != nil {
+			return nil, fmt.Errorf("flow %s: %w", name, err)
+		}
+	}
+	if saved.GlobalVars, err = e.encodeVars(s.state.globalVars); err != nil {
+		return nil, err
+	}
+	for c, count := range s.state.visitCounts {
+		saved.VisitCounts[c.Path()] = count
+	}
+	for c, turn := range s.state.lastTurn {
+		saved.LastTurn[c.Path()] = turn
+	}
+	for _, val := range reversed(s.evaluationStack.Values()) {
+		v, err := e.encodeValue(val)
+		if err != nil {
+			return nil, err
+		}
+		saved.EvaluationStack = append(saved.EvaluationStack, v)
+	}
+	return json.Marshal(saved)
+}
+
+// Restores a state created by SaveState. LoadState is used in place of Start
+func (s *Story) LoadState(data []byte) error {
+	saved := savedStory{}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+	s.computedLists = s.ink.ListDefs.GetListValItems()
+	d := stateDecoder{root: &s.ink.Root, lists: s.computedLists}
+
+	state := NewStoryState()
+	var err error
+	if state.globalVars, err = d.decodeVars(saved.GlobalVars); err != nil {
+		return err
+	}
+	for p, count := range saved.VisitCounts {
+		c, err := s.ink.Root.ContainerAtPath(p)
+		if err != nil {
+			return err
+		}
+		state.visitCounts[c] = count
+	}
+	for p, turn := range saved.LastTurn {
+		c, err := s.ink.Root.ContainerAtPath(p)
+		if err != nil {
+			return err
+		}
+		state.lastTurn[c] = turn
+	}
+	state.TurnCount = saved.TurnCount
+	state.storySeed = saved.StorySeed
+	state.previousRandom = saved.PreviousRandom
+
+	evalStack := []any{}
+	for _, v := range saved.EvaluationStack {
+		val, err := d.decodeValue(v)
+		if err != nil {
+			return err
+		}
+		evalStack = append(evalStack, val)
+	}
+	current, err := d.decodeFlow(saved.FlowName, saved.savedFlow)
+	if err != nil {
+		return err
+	}
+	flows := map[string]*Flow{}
+	for name, sf := range saved.Flows {
+		if flows[name], err = d.decodeFlow(name, sf); err != nil {
+			return fmt.Errorf("flow %s: %w", name, err)
+		}
+	}
+
+	// everything decoded, swap in the new state
+	s.state = state
+	s.evaluationStack.Clear()
+	for _, val := range evalStack {
+		s.evaluationStack.Push(val)
+	}
+	s.stringMarker = saved.StringMarker
+	s.tagMarker = saved.TagMarker
+	s.loadFlow(current)
+	s.mode = saved.Current.Mode
+	s.flows = flows
+	return nil
+}
+
+type stateEncoder struct {
+	listNames   map[*types.ListValItem]string
+	originNames map[*types.ListVal]string
+}
+
+// A list value. Origins are only needed for lists without items
+type savedList struct {
+	Items   []string `json:"items"`
+	Origins []string `json:"origins,omitempty"`
+}
+
+func (e stateEncoder) encodeValue(val any) (savedValue, error) {
+	var typ string
+	var raw any
+	switch v := val.(type) {
+	case types.IntVal:
+		typ, raw = "int", int(v)
+	case types.FloatVal:
+		typ, raw = "float", float64(v)
+	case types.BoolVal:
+		typ, raw = "bool", bool(v)
+	case types.StringVal:
+		typ, raw = "str", string(v)
+	case types.VoidVal:
+		return savedValue{Type: "void"}, nil
+	case types.Tag:
+		typ, raw = "tag", string(v)
+	case types.DivertTarget:
+		typ, raw = "divert", string(v)
+	case types.VariablePointer:
+		typ, raw = "pointer", savedPointer{Name: v.Name, ContextIndex: v.ContextIndex}
+	case types.ListVal:
+		items := []string{}
+		// in the order they were added, which LIST_RANDOM depends on
+		for _, item := range v.ToSlice() {
+			name, ok := e.listNames[item]
+			if !ok {
+				return savedValue{}, fmt.Errorf("list item %s doesn't belong to a defined list", item.Name)
+			}
+			items = append(items, name)
+		}
+		lst := savedList{Items: items}
+		if v.Count() == 0 {
+			for _, origin := range v.Origins {
+				lst.Origins = append(lst.Origins, e.originNames[origin])
+			}
+		}
+		typ, raw = "list", lst
+	default:
+		return savedValue{}, fmt.Errorf("can't save value of type %T", val)
+	}
+	js, err := json.Marshal(raw)
+	if err != nil {
+		return savedValue{}, err
+	}
+	return savedValue{Type: typ, Value: js}, nil
+}
+
+func (e stateEncoder) encodeVars(vars map[string]any) (map[string]savedValue, error) {
+	res := make(map[string]savedValue, len(vars))
+	for name, val := range vars {
+		v, err := e.encodeValue(val)
+		if err != nil {
+			return nil, fmt.Errorf("var %s: %w", name, err)
+		}
+		res[name] = v
+	}
+	return res, nil
+}
+
+func (e stateEncoder) encodeThread(t *Thread) (savedThread, error) {
+	st := savedThread{Current: savedState{Mode: t.mode, Address: encodeAddress(t.address)}}
+	for _, f := range t.callStack.frames {
+		temps, err := e.encodeVars(f.temps)
+		if err != nil {
+			return savedThread{}, err
+		}
+		st.Frames = append(st.Frames, savedFrame{
+			Type:        f.Type,
+			Return:      encodeAddress(f.returnAddress),
+			ReturnMode:  f.returnMode,
+			OutputStart: f.outputStart,
+			Temps:       temps,
+		})
+	}
+	return st, nil
+}
+
+func (e stateEncoder) encodeFlow(f *Flow, mode Mode) (savedFlow, error) {
+	sf := savedFlow{
+		CurrentTags: f.currentTags,
+		Lines:       f.lines,
+		Segments:    f.segments,
+		Done:        f.done,
+		Finished:    f.finished,
+		Text:        f.text,
+	}
+	for _, o := range f.outputBuffer {
+		sf.OutputBuffer = append(sf.OutputBuffer, savedOutput{
+			Text:     o.text,
+			Glue:     o.glue,
+			Glued:    o.glued,
+			Function: o.function,
+			Source:   encodeAddress(o.source),
+		})
+	}
+	for _, t := range f.outputTags {
+		sf.OutputTags = append(sf.OutputTags, savedOutputTag{Tag: t.tag, Pos: t.pos})
+	}
+	for _, c := range f.currentChoices {
+		choice := savedChoice{
+			Text:           c.text,
+			ChoiceOnlyText: c.choiceOnlyText,
+			Destination:    *encodeAddress(c.Destination),
+			OnlyDefault:    c.OnlyDefault,
+			Tags:           c.Tags,
+		}
+		if c.thread != nil {
+			t, err := e.encodeThread(c.thread)
+			if err != nil {
+				return savedFlow{}, err
+			}
+			choice.Thread = &t
+		}
+		sf.CurrentChoices = append(sf.CurrentChoices, choice)
+	}
+	// the running thread is saved the same way as a forked one
+	current, err := e.encodeThread(&Thread{address: f.currentAddress, mode: mode, callStack: f.callStack})
+	if err != nil {
+		return savedFlow{}, err
+	}
+	sf.Current = current.Current
+	sf.Frames = current.Frames
+	for _, t := range reversed(f.threads.Values()) {
+		st, err := e.encodeThread(t)
+		if err != nil {
+			return savedFlow{}, err
+		}
+		sf.Threads = append(sf.Threads, st)
+	}
+	return sf, nil
+}
+
+func encodeAddress(a Address) *savedAddress {
+	// the story hasn't started yet
+	if a.C == nil {
+		return nil
+	}
+	return &savedAddress{Path: a.C.Path(), Index: a.I}
+}
+
+type stateDecoder struct {
+	root  *types.Container
+	lists map[string]types.ListVal
+}
+
+func (d stateDecoder) decodeValue(v savedValue) (any, error) {
+	var err error
+	switch v.Type {
+	case "int":
+		var i int
+		err = json.Unmarshal(v.Value, &i)
+		return types.IntVal(i), err
+	case "float":
+		var f float64
+		err = json.Unmarshal(v.Value, &f)
+		return types.FloatVal(f), err
+	case "bool":
+		var b bool
+		err = json.Unmarshal(v.Value, &b)
+		return types.BoolVal(b), err
+	case "str":
+		var str string
+		err = json.Unmarshal(v.Value, &str)
+		return types.StringVal(str), err
+	case "void":
+		return types.VoidVal{}, nil
+	case "tag":
+		var str string
+		err = json.Unmarshal(v.Value, &str)
+		return types.Tag(str), err
+	case "divert":
+		var str string
+		err = json.Unmarshal(v.Value, &str)
+		return types.DivertTarget(str), err
+	case "pointer":
+		var p savedPointer
+		err = json.Unmarshal(v.Value, &p)
+		return types.VariablePointer{Name: p.Name, ContextIndex: p.ContextIndex}, err
+	case "list":
+		var saved savedList
+		if err = json.Unmarshal(v.Value, &saved); err != nil {
+			return nil, err
+		}
+		lst := types.NewListVal()
+		for _, name := range saved.Origins {
+			def, ok := d.lists[name]
+			if !ok {
+				return nil, fmt.Errorf("no list named %s", name)
+			}
+			lst.Origins = append(lst.Origins, def.Origins...)
+		}
+		for _, name := range saved.Items {
+			listName, itemName, _ := strings.Cut(name, ".")
+			item := d.lists[listName].Get(itemName)
+			if item == nil {
+				return nil, fmt.Errorf("no list item named %s", name)
+			}
+			lst.Add(item)
+		}
+		return lst, nil
+	default:
+		return nil, fmt.Errorf("unrecognized saved value type %q", v.Type)
+	}
+}
+
+func (d stateDecoder) decodeVars(vars map[string]savedValue) (map[string]any, error) {
+	res := make(map[string]any, len(vars))
+	for name, v := range vars {
+		val, err := d.decodeValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("var %s: %w", name, err)
+		}
+		res[name] = val
+	}
+	return res, nil
+}
+
+func (d stateDecoder) decodeAddress(a *savedAddress) (Address, error) {
+	if a == nil {
+		return Address{}, nil
+	}
+	c, err := d.root.ContainerAtPath(a.Path)
+	if err != nil {
+		return Address{}, err
+	}
+	return Address{C: c, I: a.Index}, nil
+}
+
+func (d stateDecoder) decodeFrame(sf savedFrame) (*Frame, error) {
+	addr, err := d.decodeAddress(sf.Return)
+	if err != nil {
+		return nil, err
+	}
+	temps, err := d.decodeVars(sf.Temps)
+	if err != nil {
+		return nil, err
+	}
+	return &Frame{
+		Type:          sf.Type,
+		returnAddress: addr,
+		returnMode:    sf.ReturnMode,
+		outputStart:   sf.OutputStart,
+		temps:         temps,
+	}, nil
+}
+
+func (d stateDecoder) decodeFlow(name string, sf savedFlow) (*Flow, error) {
+	f := &Flow{
+		name:           name,
+		threads:        arraystack.New[*Thread](),
+		currentChoices: []Choice{},
+		currentTags:    sf.CurrentTags,
+		lines:          sf.Lines,
+		segments:       sf.Segments,
+		text:           sf.Text,
+		done:           sf.Done,
+		finished:       sf.Finished,
+	}
+	for _, c := range sf.CurrentChoices {
+		dest, err := d.decodeAddress(&c.Destination)
+		if err != nil {
+			return nil, err
+		}
+		choice := Choice{
+			text:           c.Text,
+			choiceOnlyText: c.ChoiceOnlyText,
+			Destination:    dest,
+			OnlyDefault:    c.OnlyDefault,
+			Tags:           c.Tags,
+		}
+		if c.Thread != nil {
+			if choice.thread, err = d.decodeThread(*c.Thread); err != nil {
+				return nil, err
+			}
+		}
+		f.currentChoices = append(f.currentChoices, choice)
+	}
+	for _, o := range sf.OutputBuffer {
+		source, err := d.decodeAddress(o.Source)
+		if err != nil {
+			return nil, err
+		}
+		f.outputBuffer = append(f.outputBuffer, outputItem{
+			text:     o.Text,
+			glue:     o.Glue,
+			glued:    o.Glued,
+			function: o.Function,
+			source:   source,
+		})
+	}
+	for _, t := range sf.OutputTags {
+		f.outputTags = append(f.outputTags, outputTag{tag: t.Tag, pos: t.Pos})
+	}
+	current, err := d.decodeThread(savedThread{Current: sf.Current, Frames: sf.Frames})
+	if err != nil {
+		return nil, err
+	}
+	f.currentAddress = current.address
+	f.callStack = current.callStack
+	for _, st := range sf.Threads {
+		t, err := d.decodeThread(st)
+		if err != nil {
+			return nil, err
+		}
+		f.threads.Push(t)
+	}
+	return f, nil
+}
+
+func (d stateDecoder) decodeThread(st savedThread) (*Thread, error) {
+	addr, err := d.decodeAddress(st.Current.Address)
+	if err != nil {
+		return nil, err
+	}
+	if len(st.Frames) == 0 {
+		return nil, fmt.Errorf("saved thread has no call stack")
+	}
+	t := &Thread{address: addr, mode: st.Current.Mode, callStack: &CallStack{}}
+	for _, sf := range st.Frames {
+		f, err := d.decodeFrame(sf)
+		if err != nil {
+			return nil, err
+		}
+		t.callStack.push(f)
+	}
+	return t, nil
+}
+
+// stack values are returned top first, saves store them bottom first
+func reversed[T any](vals []T) []T {
+	slices.Reverse(vals)
+	return vals
+}
@@ -0,0 +1,81 @@
+package runtime
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// plays through each story, saving and loading into a fresh story before every
+// step. The output should match an uninterrupted playthrough
+func TestSaveAndLoadState(t *testing.T) {
+	testCases := []struct {
+		desc            string
+		inkJsonFilePath string
+		choices         []int
+	}{
+		{
+			desc:            "Choices",
+			inkJsonFilePath: "../../examples/easy.json",
+			choices:         []int{1},
+		},
+		{
+			desc:            "Fallback Choices",
+			inkJsonFilePath: "../../examples/fallback.json",
+			choices:         []int{0, 0},
+		},
+		{
+			desc:            "Threads",
+			inkJsonFilePath: "../../examples/thread.json",
+			choices:         []int{1},
+		},
+		{
+			desc:            "Lists",
+			inkJsonFilePath: "../../examples/lists.json",
+		},
+		{
+			desc:            "Functions and Refs",
+			inkJsonFilePath: "../../examples/varsnfuncs.json",
+		},
+		{
+			desc:            "Crime Scene",
+			inkJsonFilePath: "../../examples/crimescene.json",
+			choices:         []int{0, 1, 0, 2, 0, 1, 0},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			assert := assert.New(t)
+			js, err := os.ReadFile(tC.inkJsonFilePath)
+			assert.NoError(err)
+			play := func(reload bool) []string {
+				s := NewStory(parseInk(t, js))
+				assert.NoError(s.Start())
+				output := []string{}
+				choiceIdx := 0
+				for !s.IsFinished() {
+					if reload {
+						data, err := s.SaveState()
+						assert.NoError(err)
+						s = NewStory(parseInk(t, js))
+						assert.NoError(s.LoadState(data))
+					}
+					state, err := s.Step()
+					assert.NoError(err)
+					txt, _ := state.GetTextAndTags()
+					output = append(output, txt)
+					if !state.CanContinue() && len(state.GetChoices()) > 0 {
+						if choiceIdx >= len(tC.choices) {
+							break
+						}
+						assert.NoError(s.ChoseIndex(tC.choices[choiceIdx]))
+						choiceIdx++
+					}
+				}
+				return output
+			}
+			assert.Equal(play(false), play(true))
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package runtime
 
 import (
+	"math/rand"
 	"strings"
 
 	"github.com/awwithro/goink/pkg/parser/types"
@@ -11,23 +12,31 @@ type StoryState struct {
 	globalVars     map[string]any
 	currentChoices []Choice
 	currentTags    []types.Tag
-	tmpVars        map[string]any
+	outputTags     []outputTag // tags written since the output was last flushed
+	lines          []Line
+	segments       []Segment
+	callStack      *CallStack
 	done           bool
 	Finished       bool
 	visitCounts    map[*types.Container]int
 	lastTurn       map[*types.Container]int
 	TurnCount      int
 	text           string
+	storySeed      int
+	previousRandom int
+	waiting        *PendingExternal // the external call the story is suspended on
 }
 
 func NewStoryState() *StoryState {
 	s := &StoryState{
 		globalVars:     make(map[string]any),
 		currentChoices: []Choice{},
-		tmpVars:        make(map[string]any),
+		callStack:      newCallStack(),
 		visitCounts:    make(map[*types.Container]int),
 		lastTurn:       make(map[*types.Container]int),
 		TurnCount:      1,
+		// matches the reference runtime which picks a seed under 100
+		storySeed: rand.Intn(100),
 	}
 	return s
 }
@@ -52,15 +61,12 @@ func (s *StoryState) GetChoices() []Choice {
 
 func (s *StoryState) SetVar(name string, val any) {
 	log.Debugf("setting %s to %v", name, val)
-	s.tmpVars[name] = val
+	s.callStack.current().temps[name] = val
 }
 
-func (s *StoryState) GetVar(name string) any {
-	if v, ok := s.tmpVars[name]; ok {
-		return v
-	}
-	log.Panicf("no var named %s", name)
-	return nil
+func (s *StoryState) GetVar(name string) (any, bool) {
+	v, ok := s.callStack.current().temps[name]
+	return v, ok
 }
 
 type Choice struct {
@@ -68,10 +74,13 @@ type Choice struct {
 	choiceOnlyText string
 	Destination    Address
 	OnlyDefault    bool
+	Tags           []types.Tag // tags written in the choice's text
+	thread         *Thread     // the thread the choice was generated in
 }
 
+// The text to show for the choice with the spaces around it trimmed
 func (c Choice) ChoiceText() string {
-	return c.text + c.choiceOnlyText
+	return strings.Trim(c.text+c.choiceOnlyText, " \t")
 }
 func (c Choice) storyText() string {
 	return c.text
@@ -80,16 +89,17 @@ func (c Choice) storyText() string {
 func (s *StoryState) RecordContainer(a Address) {
 	c := a.C
 	idx := a.I
+	if c.CountStartOnly() && idx != 0 {
+		return
+	}
 	if c.RecordVisits() {
-		if !c.CountStartOnly() || idx == 0 {
-			// A little odd, counts get recorded on entry but the visit operator
-			// treats the count as prior visits. Therefore, a !ok map means we've never visited
-			// a 0 means this is our first visit ...etc.
-			if _, ok := s.visitCounts[c]; ok {
-				s.visitCounts[c] += 1
-			} else {
-				s.visitCounts[c] = 0
-			}
+		// A little odd, counts get recorded on entry but the visit operator
+		// treats the count as prior visits. Therefore, a !ok map means we've never visited
+		// a 0 means this is our first visit ...etc.
+		if _, ok := s.visitCounts[c]; ok {
+			s.visitCounts[c] += 1
+		} else {
+			s.visitCounts[c] = 0
 		}
 	}
 	if c.RecordTurns() {
@@ -102,53 +112,143 @@ func (s *StoryState) setDone(x bool) {
 }
 
 func (s *StoryState) CanContinue() bool {
-	if len(s.currentChoices) > 0 && s.done || s.Finished {
+	if len(s.currentChoices) > 0 && s.done || s.Finished || s.waiting != nil {
 		return false
 	}
 	return true
 }
 
+// True while the story is suspended on an asynchronous external function.
+// The story continues once the function is resolved with ResolveExternal
+func (s *StoryState) IsWaiting() bool {
+	return s.waiting != nil
+}
+
 func (s *StoryState) GetTextAndTags() (string, []types.Tag) {
 	text := CleanOutput(s.text)
 	tags := s.currentTags
 	s.text = ""
 	s.currentTags = []types.Tag{}
+	s.lines = nil
+	s.segments = nil
 	return text, tags
 }
 
-func (s *StoryState) LastTurnVisited(c *types.Container) int {
-	return s.lastTurn[c]
+// Returns the output of the story as segments that keep track of where each
+// piece of text came from. The text is left as written so it isn't cleaned
+// up the way GetTextAndTags does
+func (s *StoryState) GetSegments() []Segment {
+	return s.segments
+}
+
+// A Line is a single line of output along with the tags that belong to it
+type Line struct {
+	Text     string
+	Tags     []types.Tag
+	Segments []Segment `json:",omitempty"`
 }
 
+// Returns the output of the story split into lines. Unlike GetTextAndTags,
+// each tag is attached to the line it was written on
+func (s *StoryState) GetLines() []Line {
+	return s.lines
+}
+
+// A tag along with the position in the output buffer it was written at
+type outputTag struct {
+	tag types.Tag
+	pos int
+}
+
+// Splits the written output into lines. A tag belongs to the line being
+// written when it was encountered so a tag on a line of its own is attached
+// to the line that follows it
+func splitLines(items []outputItem, tags []outputTag) []Line {
+	lines := []Line{}
+	current := Line{}
+	text := strings.Builder{}
+	endLine := func() {
+		current.Text = CleanOutput(text.String())
+		text.Reset()
+		// lines without any text carry their tags forward
+		if current.Text != "" {
+			lines = append(lines, current)
+			current = Line{}
+		}
+		current.Segments = nil
+	}
+	for x, item := range items {
+		for len(tags) > 0 && tags[0].pos <= x {
+			current.Tags = append(current.Tags, tags[0].tag)
+			tags = tags[1:]
+		}
+		if item.glue {
+			continue
+		}
+		for y, part := range strings.Split(item.text, "\n") {
+			if y > 0 {
+				endLine()
+			}
+			text.WriteString(part)
+			if part != "" {
+				current.Segments = append(current.Segments, item.segment(part, current.Tags))
+			}
+		}
+	}
+	for _, t := range tags {
+		current.Tags = append(current.Tags, t.tag)
+	}
+	endLine()
+	if len(current.Tags) > 0 {
+		lines = append(lines, current)
+	}
+	return lines
+}
+
+// Returns the turn the container was last visited on. False if it's never
+// been visited
+func (s *StoryState) LastTurnVisited(c *types.Container) (int, bool) {
+	turn, ok := s.lastTurn[c]
+	return turn, ok
+}
+
+// The number of choices that have been made, as returned by TURNS()
+func (s *StoryState) turnsTaken() int {
+	return s.TurnCount - 1
+}
+
+// Collapses runs of inline whitespace to a single space, trims whitespace
+// from the start and end of lines and removes duplicate newlines. Works on
+// runes so multi-byte text is left intact
 func CleanOutput(str string) string {
 	sb := strings.Builder{}
+	sb.Grow(len(str))
+	runes := []rune(str)
 	currentWhitespaceStart := -1
 	startOfLine := 0
 
-	for i := 0; i < len(str); i++ {
-		c := string(str[i])
-		isInlineWhitespace := (c == " " || c == "\t")
+	for i, c := range runes {
+		isInlineWhitespace := c == ' ' || c == '\t'
 
 		if isInlineWhitespace && currentWhitespaceStart == -1 {
 			currentWhitespaceStart = i
 		}
 		if !isInlineWhitespace {
-			if c == "\n" && i != len(str)-1 && string(str[i+1])=="\n"{
+			if c == '\n' && i != len(runes)-1 && runes[i+1] == '\n' {
 				continue
 			}
-			if c != "\n" && currentWhitespaceStart > 0 && currentWhitespaceStart != startOfLine {
-				sb.WriteString(" ")
+			if c != '\n' && currentWhitespaceStart > 0 && currentWhitespaceStart != startOfLine {
+				sb.WriteRune(' ')
 			}
 			currentWhitespaceStart = -1
 		}
 
-		if c == "\n" {
+		if c == '\n' {
 			startOfLine = i + 1
 		}
 		if !isInlineWhitespace {
-			sb.WriteString(c)
+			sb.WriteRune(c)
 		}
-
 	}
 
 	return sb.String()
@@ -0,0 +1,61 @@
+package runtime
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCleanOutput(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		input    string
+		expected string
+	}{
+		{
+			desc:     "Accented text",
+			input:    "café  au   lait\n",
+			expected: "café au lait\n",
+		},
+		{
+			desc:     "Combining marks",
+			input:    "café \t noir",
+			expected: "café noir",
+		},
+		{
+			desc:     "Japanese with duplicate newlines",
+			input:    "日本語 \n\n テキスト",
+			expected: "日本語\nテキスト",
+		},
+		{
+			desc:     "Emoji separated by tabs",
+			input:    "🙂\t\t🙂",
+			expected: "🙂 🙂",
+		},
+		{
+			desc:     "Leading whitespace before multi-byte text",
+			input:    "Ça va\n   ñandú",
+			expected: "Ça va\nñandú",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			assert.Equal(t, tC.expected, CleanOutput(tC.input))
+		})
+	}
+}
+
+func TestMultiByteGlue(t *testing.T) {
+	// Voilà
+	// <>  été
+	// 東京
+	// <>   駅
+	js := `{"inkVersion":21,"root":[["^Voilà","\n","<>","^  été","\n","^東京","\n","<>","^   駅","\n","end",null],"done",{"#f":1}],"listDefs":{}}`
+	assert := assert.New(t)
+	s := NewStory(parseInk(t, []byte(js)))
+	assert.NoError(s.Start())
+	state, err := s.RunContinuous()
+	assert.NoError(err)
+	text, _ := state.GetTextAndTags()
+	assert.Equal("Voilà été\n東京 駅\n", text)
+}
@@ -1,6 +1,8 @@
 package runtime
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strings"
 
@@ -28,36 +30,70 @@ func (a *Address) Increment() {
 	a.I++
 }
 
-type State struct {
-	mode    Mode
-	address Address
-	tmpVars *map[string]any
+// A Thread is a snapshot of the call stack. Threads are forked by the
+// thread command and resumed when the current thread finishes
+type Thread struct {
+	address   Address
+	mode      Mode
+	callStack *CallStack
 }
 
 type Story struct {
-	ink             types.Ink
-	evaluationStack stacks.Stack[any]
-	outputBuffer    stacks.Stack[string]
-	mode            Mode
-	stringMarker    int //Used to track index of stack to concatenate into a string
-	state           *StoryState
-	currentAddress Address
-	previousState  stacks.Stack[State]
-	extFuncs       map[string]func([]any) any
-	computedLists  map[string]types.ListVal
-}
-
-func NewStory(ink types.Ink) Story {
+	ink                   types.Ink
+	evaluationStack       stacks.Stack[any]
+	outputBuffer          []outputItem
+	mode                  Mode
+	stringMarker          int //Used to track index of stack to concatenate into a string
+	tagMarker             int //Used to track index of stack to concatenate into a tag
+	state                 *StoryState
+	currentAddress        Address
+	threads               stacks.Stack[*Thread]
+	extFuncs              map[string]externalFunction
+	computedLists         map[string]types.ListVal
+	observers             map[string][]VariableObserver
+	allObservers          []VariableObserver
+	observerBatch         int            // observers are notified once this drops to 0
+	changedVars           map[string]any // values of vars before they changed in this batch
+	changedOrder          []string
+	flowName              string
+	flows                 map[string]*Flow // every flow other than the current one
+	limits                Limits
+	ctx                   context.Context // the context of the call running the story
+	instructions          int             // instructions evaluated by the current call
+	continuing            bool            // a run started by ContinueFor hasn't finished
+	continuedInstructions int
+}
+
+// Configures a story created by NewStory
+type StoryOption func(*Story)
+
+// Seeds the story's random number generator so RANDOM, shuffles and
+// LIST_RANDOM give the same results on every playthrough
+func WithSeed(seed int) StoryOption {
+	return func(s *Story) {
+		s.state.storySeed = seed
+		s.state.previousRandom = 0
+	}
+}
+
+func NewStory(ink types.Ink, opts ...StoryOption) Story {
 	s := Story{
 		ink:             ink,
 		evaluationStack: arraystack.New[any](),
-		outputBuffer:    arraystack.New[string](),
 		mode:            None,
 		stringMarker:    -1,
+		tagMarker:       -1,
 		state:           NewStoryState(),
-		previousState:   arraystack.New[State](),
-		extFuncs:        map[string]func([]any) any{},
+		threads:         arraystack.New[*Thread](),
+		extFuncs:        map[string]externalFunction{},
 		computedLists:   map[string]types.ListVal{},
+		observers:       map[string][]VariableObserver{},
+		changedVars:     map[string]any{},
+		flowName:        DefaultFlowName,
+		flows:           map[string]*Flow{},
+	}
+	for _, opt := range opts {
+		opt(&s)
 	}
 	return s
 }
@@ -78,60 +114,65 @@ func (s *Story) endEvalMode() {
 	if s.mode != Eval {
 		panicInvalidModeTransition(s.mode, None, s)
 	}
+	if s.tagMarker >= 0 {
+		// dynamic tags evaluate their content from within tag mode
+		s.mode = TagMode
+		return
+	}
 	s.mode = None
 }
 
 func (s *Story) startStrMode() {
 	s.mode = Str
-	s.stringMarker = s.outputBuffer.Size()
+	s.stringMarker = len(s.outputBuffer)
 }
 
 func (s *Story) endStrMode() {
 	s.mode = Eval
-	if s.outputBuffer.Size() == s.stringMarker {
-		log.Panic("No elements could be popped from the output buffer")
-	}
-	result := strings.Builder{}
-	items := s.outputBuffer.Size() - s.stringMarker
-	for items > 0 {
-		val, _ := s.outputBuffer.Pop()
-		result.WriteString(val)
-		items--
-	}
-	s.evaluationStack.Push(types.StringVal(result.String()))
+	s.evaluationStack.Push(types.StringVal(s.popOutputSince(s.stringMarker)))
 	s.stringMarker = -1
 }
 
+// Pops everything written to the output since marker, joined in the order
+// it was written
+func (s *Story) popOutputSince(marker int) string {
+	text := outputText(s.outputBuffer[marker:])
+	s.outputBuffer = s.outputBuffer[:marker]
+	return text
+}
+
+// Tags can be written as part of the output or, for tags in choice text,
+// while a string is being evaluated
 func (s *Story) startTagMode() {
-	if s.mode != None {
+	if s.mode != None && s.mode != Str {
 		panicInvalidModeTransition(s.mode, TagMode, s)
 	}
 	s.mode = TagMode
-	s.stringMarker = s.outputBuffer.Size()
+	s.tagMarker = len(s.outputBuffer)
 }
 
 func (s *Story) endTagMode() {
 	if s.mode != TagMode {
-		panicInvalidModeTransition(s.mode, TagMode, s)
-	}
-	s.mode = None
-	if s.outputBuffer.Size() == s.stringMarker {
-		log.Panic("No elements could be popped from the output buffer")
+		panicInvalidModeTransition(s.mode, None, s)
 	}
-	result := strings.Builder{}
-	items := s.outputBuffer.Size() - s.stringMarker
-	for items > 0 {
-		val, _ := s.outputBuffer.Pop()
-		result.WriteString(val)
-		items--
+	// whitespace around a tag's text is dropped the same as in a line
+	tag := types.Tag(CleanOutput(s.popOutputSince(s.tagMarker)))
+	s.tagMarker = -1
+	if s.stringMarker >= 0 {
+		// a tag in choice text goes on the stack to be picked up by the
+		// choice point along with the choice's text
+		s.mode = Str
+		s.evaluationStack.Push(tag)
+		return
 	}
-	s.state.currentTags = append(s.state.currentTags, types.Tag(result.String()))
-	s.stringMarker = -1
+	s.mode = None
+	s.state.currentTags = append(s.state.currentTags, tag)
+	s.state.outputTags = append(s.state.outputTags, outputTag{tag: tag, pos: len(s.outputBuffer)})
 }
 
 func (s *Story) popOutput() {
 	str := mustPopStack[fmt.Stringer](s.evaluationStack)
-	s.outputBuffer.Push(str.String())
+	s.pushOutput(str.String())
 }
 
 func (s *Story) pushVisitCount() {
@@ -152,7 +193,7 @@ func panicInvalidModeTransition(current, attempted Mode, s *Story) {
 	if s != nil {
 		s.Panic(str)
 	}
-	log.Panic(str)
+	panic(errors.New(str))
 }
 
 // Type param is the type that was expected
@@ -161,15 +202,13 @@ func panicInvalidStackType[T any](actual any, s *Story) {
 	if s != nil {
 		s.Panic(str)
 	}
-	log.Panic(str)
+	panic(errors.New(str))
 }
 
+// Aborts evaluation of the story. The error is returned as a RuntimeError
+// from the public method that was running the story
 func (s *Story) Panic(str string) {
-	log.WithFields(log.Fields{
-		"Parent":    s.currentAddress.C.ParentContainer.Name,
-		"Container": s.currentAddress.C.Name,
-		"Index":     s.currentAddress.I,
-	}).Panic(str)
+	panic(s.newRuntimeError(str, nil))
 }
 
 func (s *Story) Panicf(str string, args ...any) {
@@ -178,16 +217,39 @@ func (s *Story) Panicf(str string, args ...any) {
 
 // List names are set as global vars in "global defs" while list elements
 // are generated by the runtime
-func (s *Story) Start() {
+func (s *Story) Start() (err error) {
+	defer s.recoverRuntimeError(&err)
+	if err := s.validateExternalFunctions(); err != nil {
+		return err
+	}
 	s.generateListVars()
-	s.setupGlobalVars()
-	s.enterContainer(Address{C: s.ink.Root.Contents[0].(*types.Container), I: 0})
+	if err := s.setupGlobalVars(); err != nil {
+		return err
+	}
+	start, err := s.startAddress()
+	if err != nil {
+		return err
+	}
+	s.enterContainer(start)
+	return nil
+}
+
+// the top of the story's content
+func (s *Story) startAddress() (Address, error) {
+	if len(s.ink.Root.Contents) == 0 {
+		return Address{}, fmt.Errorf("the root container is empty")
+	}
+	start, ok := s.ink.Root.Contents[0].(*types.Container)
+	if !ok {
+		return Address{}, fmt.Errorf("the root container doesn't start with a container")
+	}
+	return Address{C: start, I: 0}, nil
 }
 
 func mustPopStack[T any](s stacks.Stack[any]) T {
 	val, ok := s.Pop()
 	if !ok {
-		log.Panic("Popped empty stack")
+		panic(errors.New("popped empty stack"))
 	}
 	log.Debugf("Popped %T %v", val, val)
 	ret, ok := val.(T)
@@ -197,12 +259,35 @@ func mustPopStack[T any](s stacks.Stack[any]) T {
 	return ret
 }
 
-func (s *Story) ResolvePath(p types.Path) Address {
-	c, i := types.ResolvePath(p, s.currentAddress.C)
-	return Address{C: c, I: i}
+func (s *Story) ResolvePath(p types.Path) (Address, error) {
+	c, i, err := types.ResolvePath(p, s.currentAddress.C)
+	if err != nil {
+		return Address{}, err
+	}
+	return Address{C: c, I: i}, nil
+}
+
+// resolves the path, aborting evaluation if it can't be found
+func (s *Story) mustResolvePath(p types.Path) Address {
+	a, err := s.ResolvePath(p)
+	if err != nil {
+		panic(s.newRuntimeError(fmt.Sprintf("failed to resolve path %s", p), err))
+	}
+	return a
 }
 
+// Evaluates the next instruction of the story
 func (s *Story) Step() (StoryState, error) {
+	return s.StepContext(context.Background())
+}
+
+func (s *Story) step() (state StoryState, err error) {
+	s.startObserverBatch()
+	defer s.endObserverBatch()
+	defer s.recoverRuntimeError(&err)
+	if s.state.IsWaiting() {
+		return *s.state, nil
+	}
 	if s.state.CanContinue() {
 		// flush any already presented text
 		s.state.text = ""
@@ -218,9 +303,10 @@ func (s *Story) Step() (StoryState, error) {
 					break
 				}
 			}
-			// if we only have a default choices, chose it
+			// if we only have a default choices, chose it. The player
+			// didn't pick it so it isn't a new turn
 			if onlyDefaults {
-				s.choose(choices[0])
+				s.choose(choices[0], false)
 				s.state.setDone(true)
 			} else {
 				// we have a choice to be made, write the story so far
@@ -234,46 +320,68 @@ func (s *Story) Step() (StoryState, error) {
 	return *s.state, nil
 }
 
+// Evaluates the next instruction. Reaching the end of a container moves on
+// to whatever follows it, looping until an instruction is evaluated or the
+// story stops
 func (s *Story) reEnterStory() {
-	s.state.setDone(false)
-	if s.currentAddress.AtEnd() {
+	for {
+		s.checkLimits()
+		s.state.setDone(false)
+		if !s.currentAddress.AtEnd() {
+			log.Debugf("Entering idx %d of Container: %v", s.currentAddress.I, s.currentAddress.C.Name)
+			log.Debugf("Item is %q, %T", s.currentAddress.C.Contents[s.currentAddress.I], s.currentAddress.C.Contents[s.currentAddress.I])
+			s.currentAddress.C.Contents[s.currentAddress.I].Accept(s)
+			return
+		}
 		log.Debug("Reached end of Container: ", s.currentAddress.C.Name)
-		// End of the story?
-		if pos, err := s.currentAddress.C.PositionInParent(); err != nil {
-			// A choice is needed
-			if len(s.state.GetChoices()) > 0 {
-				s.state.setDone(true)
-				return
-			}
-			switch err.(type) {
-			case types.EndOfSubContainer:
-				// If we've reached the end of a sub-container, this is an implicit end of the story
-				// unless there is a previous address on the stack (we're at the end of a function call)
-				if s.previousState.Size() > 0 {
-					prevState, _ := s.previousState.Pop()
-					s.restoreState(prevState)
-					// Assuming we're always returning from a function,
-					// this assumption likely doesn't hold up
-					s.evaluationStack.Push(types.VoidVal{})
-					s.reEnterStory()
-				} else {
-					s.endStory()
-				}
-			default:
-				// NoParent, at the root container
-				log.Debug("reached end of ink ", err)
-				s.endStory()
-			}
-		} else {
+		pos, err := s.currentAddress.C.PositionInParent()
+		if err == nil {
 			// pick up at the position just after the container we left
 			s.currentAddress.Set(s.currentAddress.C.ParentContainer, pos+1)
-			s.reEnterStory()
+			continue
+		}
+		_, endOfSub := err.(types.EndOfSubContainer)
+		frame := s.state.callStack.current()
+		// Running out of content in a function returns from it, even once
+		// choices have been generated since the choice text may still be
+		// being built
+		if endOfSub && (frame.Type == FunctionFrame || frame.Type == EvaluationFrame) {
+			s.implicitReturn()
+			// a function called by EvaluateFunction returns to the host
+			if s.currentAddress.C == hostContainer {
+				return
+			}
+			continue
 		}
+		// End of the story?
+		// Running out of content in a thread resumes the thread that forked it
+		if s.inThread() {
+			s.popThread()
+			continue
+		}
+		// A choice is needed
+		if len(s.state.GetChoices()) > 0 {
+			s.state.setDone(true)
+			return
+		}
+		// Tunnels only return with ->->, running out of content in one
+		// ends the story the same as anywhere else
+		if frame.Type == TunnelFrame {
+			log.Warnf("ran out of content in a tunnel called from %s", contentPath(frame.returnAddress))
+		}
+		log.Debug("reached end of ink ", err)
+		s.endStory()
 		return
-	} else {
-		log.Debugf("Entering idx %d of Container: %v", s.currentAddress.I, s.currentAddress.C.Name)
-		log.Debugf("Item is %q, %T", s.currentAddress.C.Contents[s.currentAddress.I], s.currentAddress.C.Contents[s.currentAddress.I])
-		s.currentAddress.C.Contents[s.currentAddress.I].Accept(s)
+	}
+}
+
+// Returns from the function at the top of the stack when its container runs
+// out of content without an explicit return
+func (s *Story) implicitReturn() {
+	frame := s.popFrame("the end of a function", FunctionFrame, EvaluationFrame)
+	// functions called from the host give back whatever they left on the stack
+	if frame.Type == FunctionFrame {
+		s.evaluationStack.Push(types.VoidVal{})
 	}
 }
 
@@ -286,41 +394,128 @@ func (s *Story) endStory() {
 }
 
 func (s *Story) moveToPath(path types.Path) {
-	a := s.ResolvePath(path)
+	a := s.mustResolvePath(path)
 	s.enterContainer(a)
 }
 
-func (s *Story) choose(c Choice) {
+func (s *Story) choose(c Choice, newTurn bool) {
+	// a choice resumes the thread it was generated in, which is now the
+	// only thread
+	s.threads.Clear()
+	s.restoreThread(c.thread)
+	s.state.callStack.collapseThreads()
+	// the turn starts before the destination is visited
+	if newTurn {
+		s.state.TurnCount++
+	}
 	s.enterContainer(c.Destination)
-	s.state.TurnCount++
 	s.state.currentChoices = s.state.currentChoices[:0]
+	// tags belong to the output of the turn they were written in
+	s.state.currentTags = nil
 	s.state.setDone(false)
 }
 
+// returns a copy of the current call stack that can be resumed later
+func (s *Story) forkThread() *Thread {
+	return &Thread{address: s.currentAddress, mode: s.mode, callStack: s.state.callStack.copy()}
+}
+
+// replaces the current call stack with the one in the thread
+func (s *Story) restoreThread(t *Thread) {
+	s.state.callStack = t.callStack.copy()
+	s.currentAddress = t.address
+	s.mode = t.mode
+}
+
+func (s *Story) popThread() {
+	t, _ := s.threads.Pop()
+	s.restoreThread(t)
+	log.Debugf("Resumed thread at Name: %s Idx: %d", s.currentAddress.C.Name, s.currentAddress.I)
+}
+
+// true if the current thread was forked, whatever calls it has made since.
+// Finishing a forked thread drops its frames and resumes the one that forked it
+func (s *Story) inThread() bool {
+	return !s.threads.Empty()
+}
+
 func (s *Story) enterContainer(a Address) {
 	s.currentAddress = a
 	s.state.RecordContainer(a)
 }
 
-func (s *Story) ChoseIndex(idx int) error {
+func (s *Story) ChoseIndex(idx int) (err error) {
+	defer s.recoverRuntimeError(&err)
 	if idx < 0 || idx >= len(s.state.GetChoices()) {
 		return fmt.Errorf("%d is out of range of choices: %d", idx, len(s.state.GetChoices()))
 	}
-	s.choose(s.state.GetChoices()[idx])
+	s.choose(s.state.GetChoices()[idx], true)
 	return nil
 }
 
-func (s *Story) writeToState() {
-	str := ""
-	if !s.outputBuffer.Empty() && s.mode == None {
+// Moves the story to the knot or stitch at path, e.g. "market.haggle". The call
+// stack, choices and any pending output are discarded. Args are passed to the
+// knot's parameters in order. Like taking a choice, the jump counts as a turn
+func (s *Story) ChoosePathString(path string, args ...any) error {
+	return s.ChoosePath(types.Path(path), args...)
+}
 
-		for !s.outputBuffer.Empty() {
-			text, _ := s.outputBuffer.Pop()
-			str = text + str
+func (s *Story) ChoosePath(path types.Path, args ...any) (err error) {
+	defer s.recoverRuntimeError(&err)
+	if strings.HasPrefix(string(path), types.ParentContainer) || strings.HasPrefix(string(path), ".") {
+		return fmt.Errorf("path %s must be absolute", path)
+	}
+	c, i, err := types.ResolvePath(path, &s.ink.Root)
+	if err != nil {
+		return fmt.Errorf("can't choose path %s: %w", path, err)
+	}
+	vals := make([]any, 0, len(args))
+	for x, arg := range args {
+		val, err := fromGoValue(arg)
+		if err != nil {
+			return fmt.Errorf("argument %d: %w", x, err)
 		}
+		vals = append(vals, val)
+	}
+	s.resetCallStack()
+	for _, val := range vals {
+		s.evaluationStack.Push(val)
+	}
+	log.Debug("Choosing path ", path)
+	s.state.TurnCount++
+	s.enterContainer(Address{C: c, I: i})
+	return nil
+}
+
+// Discards everything tied to the current position in the story, leaving
+// globals, visit counts and turns as is
+func (s *Story) resetCallStack() {
+	s.state.callStack = newCallStack()
+	s.threads.Clear()
+	s.evaluationStack.Clear()
+	s.outputBuffer = nil
+	s.mode = None
+	s.stringMarker = -1
+	s.tagMarker = -1
+	s.state.currentChoices = []Choice{}
+	s.state.currentTags = []types.Tag{}
+	s.state.outputTags = nil
+	s.state.lines = nil
+	s.state.segments = nil
+	s.state.text = ""
+	s.state.done = false
+	s.state.Finished = false
+}
+
+func (s *Story) writeToState() {
+	if len(s.outputBuffer) > 0 && s.mode == None {
+		str := outputText(s.outputBuffer)
 		s.state.text = str
+		s.state.lines = splitLines(s.outputBuffer, s.state.outputTags)
+		s.state.segments = outputSegments(s.outputBuffer, s.state.outputTags)
 		log.Debugf("Wrote: \"%s\"", strings.Replace(str, "\n", "\\n", -1))
-		s.outputBuffer.Clear()
+		s.outputBuffer = nil
+		s.state.outputTags = nil
 	}
 }
 
@@ -328,37 +523,34 @@ func (s *Story) IsFinished() bool {
 	return s.state.Finished
 }
 
-func (s *Story) setupGlobalVars() {
+// The current state of the story
+func (s *Story) State() StoryState {
+	return *s.state
+}
+
+func (s *Story) IsWaiting() bool {
+	return s.state.IsWaiting()
+}
+
+func (s *Story) setupGlobalVars() error {
 	c, err := s.ink.Root.GetNamedContainer(types.GlobalVarKey)
 	// no global vars to work parse
 	if err != nil {
-		return
+		return nil
 	}
 	s.currentAddress = Address{C: c, I: 0}
 	for s.state.CanContinue() {
 		if _, err := s.Step(); err != nil {
-			log.Panic("failed while parsing globals ", err)
+			return fmt.Errorf("failed while parsing globals: %w", err)
 		}
 	}
 	// Globals run until a "end" statement
 	s.state.Finished = false
+	return nil
 }
 
-func (s *Story) RunContinuous() (state StoryState, err error) {
-	run := true
-	for run {
-		if state, err = s.Step(); err != nil {
-			return state, err
-		} else if state.CanContinue() && !state.Finished {
-			continue
-		}
-		run = false
-	}
-	return state, err
-}
-
-func (s *Story) RegisterExternalFunction(name string, f func([]any) any) {
-	s.extFuncs[name] = f
+func (s *Story) RunContinuous() (StoryState, error) {
+	return s.RunContinuousContext(context.Background())
 }
 
 func (s *Story) generateListVars() {
@@ -0,0 +1,59 @@
+package runtime
+
+import (
+	"fmt"
+
+	"github.com/awwithro/goink/pkg/parser/types"
+)
+
+// Returns the tags written at the very top of the story
+func (s *Story) GlobalTags() ([]types.Tag, error) {
+	return s.TagsForContentAtPath("")
+}
+
+// Returns the tags at the start of the knot or stitch at path without running
+// it. An empty path reads the tags at the top of the story
+func (s *Story) TagsForContentAtPath(path string) ([]types.Tag, error) {
+	c := &s.ink.Root
+	if path != "" {
+		var err error
+		if c, _, err = types.ResolvePath(types.Path(path), &s.ink.Root); err != nil {
+			return nil, fmt.Errorf("can't read tags at %s: %w", path, err)
+		}
+	}
+	// content nested at the start of a knot, such as a weave, still counts
+	// as being at the start
+	for len(c.Contents) > 0 {
+		first, ok := c.Contents[0].(*types.Container)
+		if !ok {
+			break
+		}
+		c = first
+	}
+	tags := []types.Tag{}
+	inTag := false
+	for _, content := range c.Contents {
+		switch v := content.(type) {
+		case types.ControlCommand:
+			switch v {
+			case types.StartTag:
+				inTag = true
+			case types.EndTag:
+				inTag = false
+			default:
+				return tags, nil
+			}
+		case types.StringVal:
+			if !inTag {
+				return tags, nil
+			}
+			tags = append(tags, types.Tag(v))
+		default:
+			if inTag {
+				return nil, fmt.Errorf("tag at %s contains content that isn't text", path)
+			}
+			return tags, nil
+		}
+	}
+	return tags, nil
+}
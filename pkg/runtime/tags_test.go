@@ -0,0 +1,111 @@
+package runtime
+
+import (
+	"testing"
+
+	"github.com/awwithro/goink/pkg/parser/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLineTags(t *testing.T) {
+	assert := assert.New(t)
+	s := NewStory(loadExample(t, "tags"))
+	assert.NoError(s.Start())
+	state, err := s.RunContinuous()
+	assert.NoError(err)
+
+	assert.Equal([]Line{
+		{Text: "Hello", Tags: []types.Tag{"author: Joe", "title: Test", "greeting"}},
+		{Text: "Second line", Tags: []types.Tag{"portrait"}},
+		{Text: "Third", Tags: []types.Tag{"count 5"}},
+	}, stripSegments(state.GetLines()))
+
+	choices := state.GetChoices()
+	assert.Len(choices, 1)
+	assert.Equal("Open", choices[0].ChoiceText())
+	assert.Equal([]types.Tag{"door"}, choices[0].Tags)
+
+	text, tags := state.GetTextAndTags()
+	assert.Equal("Hello\nSecond line\nThird\n", text)
+	assert.Equal([]types.Tag{"author: Joe", "title: Test", "greeting", "portrait", "count 5"}, tags)
+}
+
+func TestTagsClearedByChoice(t *testing.T) {
+	assert := assert.New(t)
+	s := NewStory(loadExample(t, "tags"))
+	assert.NoError(s.Start())
+	_, err := s.RunContinuous()
+	assert.NoError(err)
+	assert.NoError(s.ChoseIndex(0))
+	state, err := s.RunContinuous()
+	assert.NoError(err)
+	_, tags := state.GetTextAndTags()
+	assert.Empty(tags)
+}
+
+func TestChoiceTagsSurviveSave(t *testing.T) {
+	assert := assert.New(t)
+	ink := loadExample(t, "tags")
+	s := NewStory(ink)
+	assert.NoError(s.Start())
+	_, err := s.RunContinuous()
+	assert.NoError(err)
+	saved, err := s.SaveState()
+	assert.NoError(err)
+
+	loaded := NewStory(ink)
+	assert.NoError(loaded.LoadState(saved))
+	choices := loaded.state.GetChoices()
+	assert.Len(choices, 1)
+	assert.Equal([]types.Tag{"door"}, choices[0].Tags)
+	assert.Equal(s.state.GetLines(), loaded.state.GetLines())
+}
+
+func TestTagsForContentAtPath(t *testing.T) {
+	s := NewStory(loadExample(t, "tags"))
+	testCases := []struct {
+		desc     string
+		path     string
+		expected []types.Tag
+		errors   bool
+	}{
+		{
+			desc:     "Global tags",
+			path:     "",
+			expected: []types.Tag{"author: Joe", "title: Test"},
+		},
+		{
+			desc:     "Knot tags",
+			path:     "knot",
+			expected: []types.Tag{"knot tag"},
+		},
+		{
+			desc:   "Missing knot",
+			path:   "nowhere",
+			errors: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			tags, err := s.TagsForContentAtPath(tC.path)
+			if tC.errors {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tC.expected, tags)
+		})
+	}
+	tags, err := s.GlobalTags()
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Tag{"author: Joe", "title: Test"}, tags)
+}
+
+// Drops the segments from the lines so tests can compare text and tags alone
+func stripSegments(lines []Line) []Line {
+	stripped := make([]Line, len(lines))
+	for x, line := range lines {
+		stripped[x] = Line{Text: line.Text, Tags: line.Tags}
+	}
+	return stripped
+}
@@ -0,0 +1,53 @@
+package runtime
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTurnsAndChoiceCount(t *testing.T) {
+	assert := assert.New(t)
+	s := NewStory(loadExample(t, "turns"))
+	assert.NoError(s.Start())
+
+	expected := []string{
+		"0 -1\n",
+		"1 0\n0\n1\n",
+		"2 1\n",
+	}
+	for x, exp := range expected {
+		state, err := s.RunContinuous()
+		assert.NoError(err)
+		text, _ := state.GetTextAndTags()
+		assert.Equal(exp, text)
+		if x < len(expected)-1 {
+			assert.NoError(s.ChoseIndex(0))
+		}
+	}
+	assert.True(s.IsFinished())
+}
+
+func TestTurnsSinceUncountedTarget(t *testing.T) {
+	// {TURNS_SINCE(-> other)} where other doesn't record turns. The compiler
+	// always records turns for TURNS_SINCE targets so this is built by hand
+	js := `{"inkVersion":21,"root":[["ev",{"^->":"other"},"turns","out","/ev","\n","done"],"done",{"other":["^Other","\n","end",{"#f":1}],"#f":1}],"listDefs":{}}`
+	s := NewStory(parseInk(t, []byte(js)))
+	assert.NoError(t, s.Start())
+	_, err := s.RunContinuous()
+	assert.ErrorContains(t, err, "doesn't record turns")
+}
+
+func TestDefaultChoiceIsNotATurn(t *testing.T) {
+	assert := assert.New(t)
+	s := NewStory(loadExample(t, "default_choice"))
+	assert.NoError(s.Start())
+	output := ""
+	for !s.IsFinished() {
+		state, err := s.RunContinuous()
+		assert.NoError(err)
+		text, _ := state.GetTextAndTags()
+		output += text
+	}
+	assert.Equal("0\n0\n", output)
+}
@@ -0,0 +1,55 @@
+package runtime
+
+import (
+	"fmt"
+
+	"github.com/awwithro/goink/pkg/parser/types"
+)
+
+// Converts an ink value to its go equivalent where one exists
+func toGoValue(val any) any {
+	switch v := val.(type) {
+	case types.BoolVal:
+		return v.AsBool()
+	case types.IntVal:
+		return v.AsInt()
+	case types.FloatVal:
+		return v.AsFloat()
+	case types.StringVal:
+		return v.String()
+	default:
+		return val
+	}
+}
+
+// Converts a go value to an ink value. Ink values are passed through as is
+func fromGoValue(val any) (any, error) {
+	switch v := val.(type) {
+	case bool:
+		return types.BoolVal(v), nil
+	case int:
+		return types.IntVal(v), nil
+	case float64:
+		return types.FloatVal(v), nil
+	case float32:
+		return types.FloatVal(v), nil
+	case string:
+		return types.StringVal(v), nil
+	case types.BoolVal, types.IntVal, types.FloatVal, types.StringVal, types.ListVal, types.DivertTarget:
+		return v, nil
+	default:
+		return nil, fmt.Errorf("can't use %T as an ink value", val)
+	}
+}
+
+// True if a and b are the same ink value. Lists compare by their items
+func sameValue(a, b any) bool {
+	if l, ok := a.(types.ListVal); ok {
+		other, ok := b.(types.ListVal)
+		return ok && l.Equals(other)
+	}
+	if _, ok := b.(types.ListVal); ok {
+		return false
+	}
+	return a == b
+}
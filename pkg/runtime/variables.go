@@ -0,0 +1,167 @@
+package runtime
+
+import (
+	"fmt"
+
+	"github.com/awwithro/goink/pkg/parser/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// Context index of the global scope. Temp scopes count up from 1 at the
+// bottom of the call stack, the same as the reference runtime
+const globalContext = 0
+
+// Context index that's resolved to wherever the var is found
+const unknownContext = -1
+
+// VariablesState resolves the story's variables. Globals are shared by the
+// whole story while temps belong to a frame of the call stack, addressed by
+// the frame's context index
+type VariablesState struct {
+	globals map[string]any
+	scopes  tempScopes
+}
+
+// the temp scopes of a call stack
+type tempScopes interface {
+	// context index of the frame that's running
+	currentContext() int
+	// temps of the frame at a context index
+	tempScope(ci int) (map[string]any, bool)
+}
+
+// The story's variables, using the call stack of the current flow
+func (s *Story) variables() VariablesState {
+	return VariablesState{globals: s.state.globalVars, scopes: s}
+}
+
+func (s *Story) currentContext() int {
+	return len(s.state.callStack.frames)
+}
+
+func (s *Story) tempScope(ci int) (map[string]any, bool) {
+	frames := s.state.callStack.frames
+	if ci < 1 || ci > len(frames) {
+		return nil, false
+	}
+	return frames[ci-1].temps, true
+}
+
+// Context index of the scope a var would be found in, the global scope
+// if there's a global of that name otherwise the current frame
+func (v VariablesState) contextIndex(name string) int {
+	if _, ok := v.globals[name]; ok {
+		return globalContext
+	}
+	return v.scopes.currentContext()
+}
+
+// Looks up a var without dereferencing pointers. An unknown context looks
+// at the globals before the temps of the current frame
+func (v VariablesState) getRaw(name string, ci int) (any, bool) {
+	if ci == globalContext || ci == unknownContext {
+		if val, ok := v.globals[name]; ok {
+			return val, true
+		}
+	}
+	if ci == globalContext {
+		return nil, false
+	}
+	if ci == unknownContext {
+		ci = v.scopes.currentContext()
+	}
+	scope, ok := v.scopes.tempScope(ci)
+	if !ok {
+		return nil, false
+	}
+	val, ok := scope[name]
+	return val, ok
+}
+
+// Looks up a var, following pointers to the value they point at
+func (v VariablesState) get(name string, ci int) (any, bool) {
+	val, ok := v.getRaw(name, ci)
+	if p, isPointer := val.(types.VariablePointer); ok && isPointer {
+		return v.valueAt(p)
+	}
+	return val, ok
+}
+
+func (v VariablesState) valueAt(p types.VariablePointer) (any, bool) {
+	return v.get(p.Name, p.ContextIndex)
+}
+
+// Gives a pointer a concrete context. A pointer to a var that's itself a
+// pointer is replaced with that pointer so refs passed through several
+// calls still point at the original var
+func (v VariablesState) resolvePointer(p types.VariablePointer) types.VariablePointer {
+	if p.ContextIndex == unknownContext {
+		p.ContextIndex = v.contextIndex(p.Name)
+	}
+	if val, ok := v.getRaw(p.Name, p.ContextIndex); ok {
+		if double, ok := val.(types.VariablePointer); ok {
+			return double
+		}
+	}
+	return p
+}
+
+// Finds the var an assignment to name writes to. Assigning to a var that
+// holds a pointer writes to the var it points at
+func (v VariablesState) assignmentTarget(name string) (string, int) {
+	ci := unknownContext
+	for {
+		val, _ := v.getRaw(name, ci)
+		p, ok := val.(types.VariablePointer)
+		if !ok {
+			break
+		}
+		name, ci = p.Name, p.ContextIndex
+	}
+	if ci == unknownContext {
+		ci = v.contextIndex(name)
+	}
+	return name, ci
+}
+
+// Sets a temp in the frame at ci. Unless it's a new declaration the temp
+// must already exist
+func (v VariablesState) setTemp(name string, ci int, val any, declare bool) error {
+	scope, ok := v.scopes.tempScope(ci)
+	if !ok {
+		return fmt.Errorf("no frame with context index %d for temp %s", ci, name)
+	}
+	if _, exists := scope[name]; !exists && !declare {
+		return fmt.Errorf("could not find temp %s to set", name)
+	}
+	log.Debugf("setting temp %s in context %d to %v", name, ci, val)
+	scope[name] = val
+	return nil
+}
+
+// Assigns a value to a var, declaring it if it's new. Reassignments follow
+// pointers so a ref param writes to the caller's var
+func (s *Story) assignVar(name string, val any, declare, global bool) {
+	vars := s.variables()
+	if declare {
+		if p, ok := val.(types.VariablePointer); ok {
+			val = vars.resolvePointer(p)
+		}
+		if global {
+			s.state.globalVars[name] = val
+			return
+		}
+		if err := vars.setTemp(name, vars.scopes.currentContext(), val, true); err != nil {
+			s.Panic(err.Error())
+		}
+		return
+	}
+	name, ci := vars.assignmentTarget(name)
+	if ci == globalContext {
+		s.setGlobalVar(name, val)
+		return
+	}
+	if err := vars.setTemp(name, ci, val, false); err != nil {
+		s.Panic(err.Error())
+	}
+}
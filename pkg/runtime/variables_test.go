@@ -0,0 +1,101 @@
+package runtime
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefParams(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		example  string
+		expected string
+	}{
+		{desc: "Global through several calls", example: "ref_global", expected: "2\n"},
+		{desc: "Temps shadowed by the callee", example: "ref_shadowed", expected: "102 10\n"},
+		{desc: "Temp passed to a tunnel", example: "ref_tunnel", expected: "5\n"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			_, state := startExample(t, tC.example)
+			text, _ := state.GetTextAndTags()
+			assert.Equal(t, tC.expected, text)
+		})
+	}
+}
+
+// a ref param passed down through a tunnel is how the Half-Orc makes his bet
+func TestSwindlestones(t *testing.T) {
+	assert := assert.New(t)
+	s, state := startExample(t, "swindlestones", WithSeed(1))
+	choiceTexts := func(state StoryState) []string {
+		texts := []string{}
+		for _, c := range state.GetChoices() {
+			texts = append(texts, c.ChoiceText())
+		}
+		return texts
+	}
+	betCounts := []string{"Bet two ...", "Bet three ...", "Bet four ...", "Bet five ...", "Bet six ...", "Bet seven ...", "Bet eight ...", "Bet nine ..."}
+
+	text, _ := state.GetTextAndTags()
+	assert.Equal("You pull up a seat at the table. The Half-Orc opposite picks his teeth with a dagger.\n"+
+		"'Ready?' he grumbles. He tosses you a stack of dice.\n", text)
+	assert.Equal([]string{"'What's the game?'", "Roll the dice"}, choiceTexts(state))
+
+	assert.NoError(s.ChoseIndex(1))
+	state, err := s.RunContinuous()
+	assert.NoError(err)
+	text, _ = state.GetTextAndTags()
+	assert.Equal("You gather up your five dice and throw them behind your palm, getting <b>one 1, two 3s and two 4s</b>.\n"+
+		"The Half-Orc rolls his five dice and snorts.\n"+
+		"'Your bet first,' the Half-Orc grumbles.\n", text)
+	// every count of dice on the table can be bet
+	assert.Equal(append(append([]string{"Bet one ..."}, betCounts...), "Bet ten ..."), choiceTexts(state))
+
+	assert.NoError(s.ChoseIndex(0))
+	state, err = s.RunContinuous()
+	assert.NoError(err)
+	text, _ = state.GetTextAndTags()
+	assert.Equal("", text)
+	assert.Equal([]string{"Bet one 1", "Bet one 2", "Bet one 3", "Bet one 4", "BACK"}, choiceTexts(state))
+
+	// The Half-Orc's bet comes back through a ref param of the tunnel that
+	// picks it. Without it his bet stays empty and he calls straight away
+	assert.NoError(s.ChoseIndex(0))
+	state, err = s.RunContinuous()
+	assert.NoError(err)
+	text, _ = state.GetTextAndTags()
+	assert.Equal("'I bet <b>one 1</b>,' you declare.\n"+
+		"'Let's see now,' the Half-Orc murmurs, scratching his chin with a hooked nail. 'I bet <b>two 1s</b>. Now - you.'\n"+
+		"[ You have <b>one 1, two 3s and two 4s</b> ]\n", text)
+	assert.Equal(append(append([]string{"Call!"}, betCounts...), "Bet ten ..."), choiceTexts(state))
+
+	// calling shows both hands and the loser gives up a die
+	assert.NoError(s.ChoseIndex(0))
+	state, err = s.RunContinuous()
+	assert.NoError(err)
+	text, _ = state.GetTextAndTags()
+	assert.Equal("\n'I call,' you declare.\n"+
+		"The dice are revealed. Alongside my <b>one 1, two 3s and two 4s</b>, he has <b>one 1, two 2s and two 4s</b>. That puts <b>two 1s </b> on the table.\n"+
+		"The Half-Orc nods in deep satisfaction, as you push one of your dice away.\n", text)
+	assert.Equal([]string{"Roll again"}, choiceTexts(state))
+
+	assert.NoError(s.ChoseIndex(0))
+	state, err = s.RunContinuous()
+	assert.NoError(err)
+	text, _ = state.GetTextAndTags()
+	assert.Equal("You gather up your four dice and throw them behind your palm, getting <b> one 2, two 3s and one 4</b>.\n"+
+		"The Half-Orc rolls his five dice and chuckles.\n"+
+		"'Let's see now,' the Half-Orc murmurs, scratching his chin with a hooked nail. 'I bet <b>one 4</b>. '\n", text)
+	assert.Equal(append([]string{"Call!"}, betCounts...), choiceTexts(state))
+}
+
+func TestAssignUnsetTemp(t *testing.T) {
+	// ~ x = 1 without declaring x, which the compiler won't output
+	js := `{"inkVersion":21,"root":[["ev",1,"/ev",{"temp=":"x","re":true},"end",null],"done",{"#f":1}],"listDefs":{}}`
+	s := NewStory(parseInk(t, []byte(js)))
+	assert.NoError(t, s.Start())
+	_, err := s.RunContinuous()
+	assert.ErrorContains(t, err, "could not find temp x to set")
+}
@@ -2,8 +2,6 @@ package runtime
 
 import (
 	"maps"
-	"math/rand"
-	"slices"
 	"strings"
 
 	"github.com/awwithro/goink/pkg/parser/types"
@@ -15,7 +13,7 @@ func (s *Story) VisitString(str types.StringVal) {
 	if s.mode == Eval {
 		s.evaluationStack.Push(str)
 	} else {
-		s.outputBuffer.Push(str.String())
+		s.pushOutput(str.String())
 	}
 	s.currentAddress.Increment()
 }
@@ -35,7 +33,13 @@ func (s *Story) VisitControlCommand(cmd types.ControlCommand) {
 	case types.Pop:
 		_ = mustPopStack[any](s.evaluationStack)
 	case types.Done:
-		s.state.setDone(true)
+		if s.inThread() {
+			s.popThread()
+			// undo the increment below, the resumed thread is already positioned
+			s.currentAddress.I--
+		} else {
+			s.state.setDone(true)
+		}
 	case types.End:
 		s.endStory()
 	case types.NoOp:
@@ -45,7 +49,7 @@ func (s *Story) VisitControlCommand(cmd types.ControlCommand) {
 	case types.Duplicate:
 		s.duplicateTopItem()
 	case types.Glue:
-		s.glue()
+		s.pushGlue()
 	case types.Void:
 		s.evaluationStack.Push(types.VoidVal{})
 	case types.ReturnFunction:
@@ -57,36 +61,25 @@ func (s *Story) VisitControlCommand(cmd types.ControlCommand) {
 	case types.EndTag:
 		s.endTagMode()
 	case types.Thread:
-		log.Warn("bypassing thread")
-		s.currentAddress.Increment()
+		s.startThread()
 	case types.Sequence:
 		s.generateSequence()
 	case types.PushTurnsSinceTarget:
 		s.pushTurnsSinceTarget()
+	case types.PushTurn:
+		s.evaluationStack.Push(types.IntVal(s.state.turnsTaken()))
+	case types.ChoiceCount:
+		s.evaluationStack.Push(types.IntVal(len(s.state.currentChoices)))
 	default:
-		log.Panic("Unimplemented Command! ", cmd)
+		s.Panicf("Unimplemented Command! %v", cmd)
 	}
 	s.currentAddress.Increment()
 }
 
 func (s *Story) VisitTmpVar(v types.TempVar) {
 	defer s.currentAddress.Increment()
-	p := mustPopStack[any](s.evaluationStack)
-	// If this is a reassignment to a variablePointer, dereference and set the target
-	if v.ReAssign {
-		val := s.state.GetVar(v.Name)
-		log.Debugf("reassignment of var: %T %v", val, val)
-		if ref, ok := val.(types.VariablePointer); ok {
-			s.setVariablePointerValue(ref, p)
-			return
-		}
-	}
-	switch val := p.(type) {
-	case types.DivertTarget:
-		s.state.SetVar(v.Name, types.Path(val))
-	default:
-		s.state.SetVar(v.Name, val)
-	}
+	val := mustPopStack[any](s.evaluationStack)
+	s.assignVar(v.Name, val, !v.ReAssign, false)
 }
 
 func (s *Story) VisitDivertTarget(divert types.DivertTarget) {
@@ -113,79 +106,127 @@ func (s *Story) VisitDivert(divert types.Divert) {
 	s.doDivert(divert)
 }
 
-// pushes the previous address onto the stack as a return val
-// increment controls if the previous address is incremented prior to pushing
-func (s *Story) pushStackDivert(divert types.Divert, increment bool) {
-	// Pushes the old address so we know where to return to
-	// after the function runs
-	oldAddr := s.currentAddress
-	if increment {
-		oldAddr.Increment()
+// pushes a frame for a function or tunnel call and diverts into it. The
+// call returns to just past the divert
+func (s *Story) pushStackDivert(divert types.Divert, frameType FrameType) {
+	returnAddr := s.currentAddress
+	returnAddr.Increment()
+	s.pushFrame(frameType, returnAddr)
+	s.doDivert(divert)
+}
+
+// pushes a new frame with its own temps. Functions track where their output
+// starts so whitespace can be trimmed from it
+func (s *Story) pushFrame(frameType FrameType, returnAddr Address) {
+	outputStart := -1
+	if frameType == FunctionFrame {
+		outputStart = len(s.outputBuffer)
 	}
-	oldVars := maps.Clone(s.state.tmpVars)
-	// reset vars for the new context
-	s.state.tmpVars = map[string]any{}
-	s.previousState.Push(State{
-		address: oldAddr,
-		mode:    s.mode,
-		tmpVars: &oldVars,
+	s.state.callStack.push(&Frame{
+		Type:          frameType,
+		returnAddress: returnAddr,
+		returnMode:    s.mode,
+		outputStart:   outputStart,
+		temps:         map[string]any{},
 	})
 	s.mode = None
-	s.doDivert(divert)
+}
+
+// pops the top frame and moves back to where it was called from. The frame
+// must be one of the expected types, cmd names what's returning for errors
+func (s *Story) popFrame(cmd string, expected ...FrameType) *Frame {
+	if s.state.callStack.current().Type == FunctionFrame {
+		s.trimFunctionEnd()
+	}
+	frame, err := s.state.callStack.pop(expected...)
+	if err != nil {
+		s.Panicf("found %s but %s", cmd, err)
+	}
+	s.currentAddress = frame.returnAddress
+	s.mode = frame.returnMode
+	return frame
 }
 
 func (s *Story) VisitFunctionDivert(f types.FunctionDivert) {
-	s.pushStackDivert(f.Divert, true)
+	s.pushStackDivert(f.Divert, FunctionFrame)
 }
 
 func (s *Story) VisitTunnelDivert(t types.TunnelDivert) {
-	s.pushStackDivert(t.Divert, false)
+	s.pushStackDivert(t.Divert, TunnelFrame)
 }
 
 func (s *Story) VisitVariableDivert(divert types.VariableDivert) {
-	// TODO: Can we have a variable divert with condition?
-	// if so, do we check for the condition or divert path first?
 	log.Debug("Visit Variable Divert ", divert.Name)
-	p := s.state.GetVar(divert.Name)
-	if path, ok := p.(types.Path); ok {
-		s.moveToPath(path)
-	} else {
-		panicInvalidStackType[types.Path](path, s)
+	// the condition is checked before the variable is looked up, same as
+	// the reference runtime
+	if divert.Conditional {
+		cond := mustPopStack[types.Truthy](s.evaluationStack)
+		if !cond.AsBool() {
+			log.Debug("Conditional divert failed")
+			s.currentAddress.Increment()
+			return
+		}
+	}
+	p, ok := s.variables().get(divert.Name, unknownContext)
+	if !ok {
+		s.Panicf("divert to unset var %s", divert.Name)
+	}
+	target, ok := p.(types.DivertTarget)
+	if !ok {
+		s.Panicf("tried to divert using %s but it holds a %T, not a divert target", divert.Name, p)
 	}
+	s.moveToPath(target.Path())
 }
 
 func (s *Story) VisitChoicePoint(p types.ChoicePoint) {
 	log.Debug("Visit Choice Point ", p.Path)
-	a := s.ResolvePath(p.Path)
+	a := s.mustResolvePath(p.Path)
 	defer s.currentAddress.Increment()
+	// the condition and choice text are popped even if the choice isn't shown
+	show := true
 	if p.HasCondition() {
 		x := mustPopStack[types.Truthy](s.evaluationStack)
-		if !x.AsBool() {
-			return
-		}
+		show = x.AsBool()
 	}
 	choice := Choice{Destination: a}
+	if p.HasChoiceOnly() {
+		choice.choiceOnlyText = s.popChoiceText(&choice)
+	}
+	if p.HasStartContent() {
+		choice.text = s.popChoiceText(&choice)
+	}
 	if p.OnceOnly() {
 		if _, ok := s.state.visitCounts[a.C]; ok {
-			return
+			show = false
 		}
 	}
-	if p.HasChoiceOnly() {
-		txt := mustPopStack[types.StringVal](s.evaluationStack)
-		choice.choiceOnlyText = txt.String()
-
-	}
-	if p.HasStartContent() {
-		txt := mustPopStack[types.StringVal](s.evaluationStack)
-		choice.text = txt.String()
-
+	if !show {
+		return
 	}
+	choice.thread = s.forkThread()
 	if p.IsInvisibleDefault() {
 		choice.OnlyDefault = true
 	}
 	s.state.currentChoices = append(s.state.currentChoices, choice)
 }
 
+// Pops a piece of choice text along with any tags that were written in it.
+// The start content is popped last so its tags end up first
+func (s *Story) popChoiceText(choice *Choice) string {
+	txt := mustPopStack[types.StringVal](s.evaluationStack)
+	tags := []types.Tag{}
+	for {
+		tag, ok := s.evaluationStack.Peek()
+		if _, isTag := tag.(types.Tag); !ok || !isTag {
+			break
+		}
+		s.evaluationStack.Pop()
+		tags = append([]types.Tag{tag.(types.Tag)}, tags...)
+	}
+	choice.Tags = append(tags, choice.Tags...)
+	return txt.String()
+}
+
 func (s *Story) VisitContainer(c *types.Container) {
 	log.Debug("Visiting Container: ", c.Name)
 	s.enterContainer(Address{C: c, I: 0})
@@ -220,190 +261,70 @@ func (s *Story) VisitVoidVal(b types.VoidVal) {
 func (s *Story) VisitGlobalVar(v types.GlobalVar) {
 	log.Debug("Visiting Global Var ", v.Name)
 	val := mustPopStack[any](s.evaluationStack)
-	s.state.globalVars[v.Name] = val
+	// declarations aren't changes, only reassignments notify observers
+	s.assignVar(v.Name, val, !v.ReAssign, true)
 	s.currentAddress.Increment()
 }
 
 func (s *Story) VisitVarRef(v types.VarRef) {
 	log.Debug("Visiting Var Ref ", v)
-	var finalVal any
-	var intermediateValue any
-
-	// first see if the var is set
-	if val, ok := s.state.tmpVars[string(v)]; ok {
-		intermediateValue = val
-	} else if val, ok = s.state.globalVars[string(v)]; ok {
-		intermediateValue = val
-	} else {
-		log.Debugf("temp %v\n", s.state.tmpVars)
+	finalVal, ok := s.variables().get(string(v), unknownContext)
+	if !ok {
+		log.Debugf("temp %v\n", s.state.callStack.current().temps)
 		log.Debugf("global %v\n", s.state.globalVars)
 		s.Panicf("ref to unset var %s\nGlobal: %v", string(v), s.state.globalVars)
 	}
-
-	// if set, see if we need to dereference a variable pointer
-	if p, ok := intermediateValue.(types.VariablePointer); ok {
-		log.Debug("Deref a pointer")
-		finalVal = s.getVariablePointerValue(p)
-	} else {
-		finalVal = intermediateValue
-	}
 	log.Debugf("Pushing val %v of type %T", finalVal, finalVal)
 	s.evaluationStack.Push(finalVal)
 	s.currentAddress.Increment()
 }
 
 func (s *Story) VisitReadCount(r types.ReadCount) {
-	addr := s.ResolvePath(types.Path(r))
+	addr := s.mustResolvePath(types.Path(r))
 	count := s.state.visitCounts[addr.C]
 	s.evaluationStack.Push(types.IntVal(count))
 	s.currentAddress.Increment()
 }
 
 func (s *Story) VisitVariablePointer(v types.VariablePointer) {
+	// a ref without a context points at the var in the scope it's found in
+	if v.ContextIndex == unknownContext {
+		v.ContextIndex = s.variables().contextIndex(v.Name)
+	}
 	s.evaluationStack.Push(v)
 	s.currentAddress.Increment()
 }
 
 func (s *Story) VisitExternalFunctionDivert(e types.ExternalFunctionDivert) {
-	if f, ok := s.extFuncs[string(e.Path)]; !ok {
-		log.Warnf("External func %s not registered, using fallback", string(e.Path))
-		s.pushStackDivert(e.Divert, true)
-	} else {
-		defer s.currentAddress.Increment()
-		args := []any{}
-		if e.Args > 0 {
-			for x := 0; x < e.Args; x++ {
-				a := mustPopStack[any](s.evaluationStack)
-				switch arg := a.(type) {
-				case types.BoolVal:
-					args = append(args, arg.AsBool())
-				case types.NumericVal:
-					if arg.IsFloat() {
-						args = append(args, arg.AsFloat())
-					} else {
-						args = append(args, arg.AsInt())
-					}
-				case types.StringVal:
-					args = append(args, arg.String())
-				default:
-					s.Panicf("Unrecognized type for external func %T", arg)
-				}
-			}
-		}
-		slices.Reverse(args)
-		res := f(args)
-		if res != nil {
-			switch val := res.(type) {
-			case int:
-				s.evaluationStack.Push(types.IntVal(val))
-			case bool:
-				s.evaluationStack.Push(types.BoolVal(val))
-			case float64:
-				s.evaluationStack.Push(types.FloatVal(val))
-			case string:
-				s.evaluationStack.Push(types.StringVal(val))
-			default:
-				s.Panicf("unrecognized return value for external func %T", val)
-			}
-		} else {
-			log.Debug("No return val from external func, pushing void")
-			s.evaluationStack.Push(types.VoidVal{})
-		}
-	}
-}
-
-func (s *Story) getVariablePointerValue(p types.VariablePointer) any {
-	// TODO: Use the ci of p to determine if global or local
-	var value any
-	if val, ok := s.state.globalVars[p.Name]; ok {
-		p.ContextIndex = 0
-		value = val
-	} else if p.ContextIndex == -1 {
-		val, ok = s.state.tmpVars[p.Name]
-		if ok {
-			value = val
-
-		} else {
-			if val, ok := s.findVarInStack(p.Name); ok {
-				value = val
-			} else {
-				s.Panicf("nil pointer, no var %s", p.Name)
-			}
-		}
-		// Could be a ref to a temp var lower in the call stack
-	} else if val, ok := s.findVarInStack(p.Name); ok {
-		value = val
-	} else {
-		s.Panicf("nil pointer, no var %s", p.Name)
-	}
-	log.Debugf("Pointer to %T: %v", value, value)
-
-	// Pointer to a pointer, keep dereffing it. First mark it as
-	// in the stack so we don't grab the same var if the name is the same
-	if ptr, ok := value.(types.VariablePointer); ok {
-		ptr.ContextIndex = 1
-		return s.getVariablePointerValue(ptr)
-	}
-	return value
+	s.callExternalFunction(e)
 }
 
-// find the vars location and set it
-func (s *Story) setVariablePointerValue(p types.VariablePointer, val any) {
-	// TODO: Use the ci of p to determine if global or local
-	log.Debugf("Setting Pointer Var, %T: %v named %s", val, val, p.Name)
-	if _, ok := s.state.globalVars[p.Name]; ok {
-		s.state.globalVars[p.Name] = val
-	} else if _, ok := s.state.tmpVars[p.Name]; ok {
-		s.state.globalVars[p.Name] = val
-	} else {
-		for _, state := range s.previousState.Values() {
-			vars := *state.tmpVars
-			_, found := vars[p.Name]
-			if found {
-				vars[p.Name] = val
-				return
-			}
-		}
-	}
-	//log.Panic()
-}
-
-func (s *Story) findVarInStack(name string) (val any, found bool) {
-	for _, state := range s.previousState.Values() {
-		vars := *state.tmpVars
-		val, found = vars[name]
-		if found {
-			break
-		}
+// returns from a tunnel. ->-> target leaves the target on the stack in place
+// of the usual void, the tunnel returns there instead of to its caller
+func (s *Story) returnTunnel() {
+	var override *types.DivertTarget
+	switch val := mustPopStack[any](s.evaluationStack).(type) {
+	case types.DivertTarget:
+		override = &val
+	case types.VoidVal:
+	default:
+		s.Panicf("expected void or a divert target for a tunnel return (->->), got %T", val)
 	}
-	// if p, ok := val.(types.VariablePointer); ok {
-	// 	return s.getVariablePointerValue(p), ok
-	// }
-
-	return val, found
-}
-
-func (s *Story) glue() {
-	val, _ := s.outputBuffer.Peek()
-	for val == "\n" {
-		s.outputBuffer.Pop()
-		log.Debug("Popped newline")
-		val, _ = s.outputBuffer.Peek()
+	s.popFrame("a tunnel return (->->)", TunnelFrame)
+	if override != nil {
+		log.Debugf("Tunnel returning onwards to %s", override.Path())
+		s.moveToPath(override.Path())
 	}
-}
-
-func (s *Story) returnTunnel() {
-	oldState, _ := s.previousState.Pop()
-	s.restoreState(oldState)
+	// undo the increment after the command, we're already where we're going
+	s.currentAddress.I--
 	log.Debugf("Tunnel Returned to Name: %s Idx: %d", s.currentAddress.C.Name, s.currentAddress.I)
 }
 
 func (s *Story) returnFunc() {
-	oldState, _ := s.previousState.Pop()
-	s.restoreState(oldState)
-	// We're returning and then continuing past without evaluating
+	s.popFrame("a function return (~ret)", FunctionFrame, EvaluationFrame)
+	// undo the increment after the command, we're already past the divert
 	s.currentAddress.I--
-	log.Debugf("Tunnel Returned to Name: %s Idx: %d", s.currentAddress.C.Name, s.currentAddress.I)
+	log.Debugf("Function Returned to Name: %s Idx: %d", s.currentAddress.C.Name, s.currentAddress.I)
 }
 
 func (s *Story) VisitListInit(l types.ListInit) {
@@ -428,19 +349,17 @@ func (s *Story) VisitListVal(l types.ListVal) {
 func (s *Story) initializeList(init types.ListInit) types.ListVal {
 	list := types.NewListVal()
 	log.Debug("init list: ", init)
+	// origins are given for empty lists so they know which list they're of
 	for _, name := range init.Origins {
 		if def, ok := s.computedLists[name]; !ok {
 			s.Panicf("origin referenced an undefined list %s", name)
 		} else {
-			for _, v := range def.ToSortedSlice() {
-				log.Debugf("appending %v to list", v)
-				list.Add(v)
-			}
+			list.Origins = append(list.Origins, def.Origins...)
 		}
 	}
 	// the list setup is odd, it references the global list name with the item
 	// name as well as the item val
-	for name := range init.List {
+	for _, name := range init.Items {
 		segs := strings.Split(name, ".")
 		list.Add(s.computedLists[segs[0]].Get(segs[1]))
 	}
@@ -448,32 +367,40 @@ func (s *Story) initializeList(init types.ListInit) types.ListVal {
 }
 
 func (s *Story) generateSequence() {
-	seq := mustPopStack[types.IntVal](s.evaluationStack)
-	val := rand.Intn(seq.AsInt()-1) + 1
-	res := types.IntVal(val)
+	numElements := mustPopStack[types.IntVal](s.evaluationStack)
+	seqCount := mustPopStack[types.IntVal](s.evaluationStack)
+	res := types.IntVal(s.shuffleIndex(numElements.AsInt(), seqCount.AsInt()))
 	log.Debugf("Generated Sequence number: %d", res.AsInt())
 	s.evaluationStack.Push(res)
 }
 
 func (s *Story) pushTurnsSinceTarget() {
-	pth := mustPopStack[any](s.evaluationStack)
-	var target Address
-	switch path := pth.(type) {
-	case types.DivertTarget:
-		target = s.ResolvePath(types.Path(path))
-	case types.Path:
-		target = s.ResolvePath(path)
-	default:
-		log.Panicf("cant use %T as path", pth)
+	divert := mustPopStack[types.DivertTarget](s.evaluationStack)
+	target := s.mustResolvePath(divert.Path())
+	if !target.C.RecordTurns() {
+		s.Panicf("TURNS_SINCE can't be used on %s since it doesn't record turns", target.C.Path())
 	}
-	turns := s.state.LastTurnVisited(target.C)
-	delta := s.state.TurnCount - turns
-	s.evaluationStack.Push(types.IntVal(delta))
-
-}
-
-func (s *Story) restoreState(oldState State) {
-	s.currentAddress = oldState.address
-	s.mode = oldState.mode
-	s.state.tmpVars = maps.Clone(*oldState.tmpVars)
+	turn, ok := s.state.LastTurnVisited(target.C)
+	if !ok {
+		s.evaluationStack.Push(types.IntVal(-1))
+		return
+	}
+	s.evaluationStack.Push(types.IntVal(s.state.TurnCount - turn))
+}
+
+// forks the current thread. The new thread runs the divert following the
+// thread command while the original resumes after the divert once it's done
+func (s *Story) startThread() {
+	t := s.forkThread()
+	t.address.I += 2
+	s.threads.Push(t)
+	// the new thread works on a copy of the temps it was forked with
+	current := s.state.callStack.current()
+	s.state.callStack.push(&Frame{
+		Type:        ThreadFrame,
+		returnMode:  s.mode,
+		outputStart: -1,
+		temps:       maps.Clone(current.temps),
+	})
+	log.Debug("Started thread, depth ", s.threads.Size())
 }